@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"cdr/cmd/common"
 	"cdr/config"
@@ -10,28 +13,76 @@ import (
 )
 
 func main() {
+	// 解析命令行参数，config 子命令执行后直接退出
+	flags := common.ParseFlags("cdr")
+
 	log.Println("话单推送系统启动...")
 
 	// 加载配置
-	cfg, err := config.LoadConfig(config.GetConfigPath())
+	configPath := flags.Path()
+	cfg, err := config.Load(configPath, flags.Overrides)
 	if err != nil {
 		log.Printf("加载配置失败: %v", err)
 		os.Exit(1)
 	}
 
+	// 初始化推送器，未完成的推送保存在持久化队列中
+	pusher, err := service.NewPusher(cfg, "cdr")
+	if err != nil {
+		log.Printf("初始化推送器失败: %v", err)
+		os.Exit(1)
+	}
+
 	// 初始化服务
-	cdrService, err := service.NewCDRService(cfg)
+	cdrService, err := service.NewCDRService(cfg, pusher)
 	if err != nil {
 		log.Printf("初始化CDR服务失败: %v", err)
 		os.Exit(1)
 	}
 
-	// 使用通用工作池处理CDR推送
-	common.StartWorkerPool(cfg.Push.Workers, func() error {
-		if err := cdrService.PushCDR(nil); err != nil {
-			log.Printf("推送CDR记录失败: %v", err)
-			return err
-		}
+	// 初始化并启动管理服务
+	admin := service.NewAdminServer(cfg, cfg.Admin.CDRListen)
+	health := service.NewHealthService(cfg, nil, cdrService, pusher)
+	health.RegisterHandlers(admin.Mux())
+	api := service.NewAdminAPI(cfg, nil, cdrService, pusher)
+	api.RegisterHandlers(admin.Mux())
+	admin.Start()
+
+	// 继续投递上次退出时未完成的推送
+	pusher.Resume()
+
+	// 收到SIGINT/SIGTERM后停止，SIGHUP用于重新加载配置
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	// 配置文件修改或收到SIGHUP时重新加载
+	reloader := service.NewConfigReloader(configPath, flags.Overrides, cfg, pusher, cdrService, health)
+	reloaderDone := make(chan struct{})
+	go func() {
+		defer close(reloaderDone)
+		reloader.Run(ctx)
+	}()
+
+	// 使用通用工作池按流量曲线生成并推送CDR，收到退出信号后停止
+	// 推送为异步提交，工作池队列已满时提交会阻塞，投递结果由推送器记录
+	// 已提交的推送不随退出信号取消，未完成的保留在持久化队列中
+	pushCtx := context.WithoutCancel(ctx)
+	common.StartWorkerPool(ctx, cfg.Push.Workers, cdrService.Load().Wait, func() error {
+		cdrService.PushCDR(pushCtx, nil)
 		return nil
 	})
+	stop() // 再次收到信号时直接退出
+	log.Println("收到退出信号，停止生成CDR")
+
+	// 先停止重新加载和修改运行参数的管理接口，之后不会再有新的呼叫、推送或配置修改
+	<-reloaderDone
+	api.Stop()
+	cfg = reloader.Current()
+
+	// 管理接口在推送器关闭前停止，避免请求访问已关闭的推送器
+	common.ShutdownAdmin(admin)
+	common.ClosePusher(cfg, pusher)
+	if err := cdrService.Close(); err != nil {
+		log.Printf("关闭CDR推送日志失败: %v", err)
+	}
+	log.Println("话单推送系统已退出")
 }
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"cdr/config"
+	"cdr/service"
+
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `用法:
+  %[1]s [选项]                             启动服务
+  %[1]s config print [--effective] [选项]  输出配置，密钥以 ****** 代替
+  %[1]s config validate [选项]             校验配置，列出全部问题及所在行号
+
+选项:
+  -config 路径   配置文件，未指定时使用环境变量 CDR_CONFIG_PATH，默认 config/config.yaml
+  -<配置项> 值   覆盖配置项，如 -push.workers 8、-retry.delays '[0, 5, 30]'
+
+每个配置项也可以通过环境变量覆盖，如 CDR_PUSH_WORKERS=8。
+优先级从高到低为：命令行参数、环境变量、配置文件、默认值。
+
+config print 默认只输出配置文件和默认值，--effective 输出合并环境变量和命令行参数后实际生效的配置。
+config validate 校验合并后的配置，通过时退出码为0，否则为1。
+`
+
+// ConfigFlags 配置文件路径和覆盖配置项的命令行参数
+type ConfigFlags struct {
+	path      *string
+	Overrides config.Overrides
+}
+
+// BindConfigFlags 在 fs 上注册 -config 和各配置项的命令行参数
+func BindConfigFlags(fs *flag.FlagSet) *ConfigFlags {
+	return &ConfigFlags{
+		path:      fs.String("config", "", "配置文件路径"),
+		Overrides: config.BindFlags(fs),
+	}
+}
+
+// Path 返回配置文件路径，未指定 -config 时使用 config.GetConfigPath
+func (f *ConfigFlags) Path() string {
+	if *f.path != "" {
+		return *f.path
+	}
+	return config.GetConfigPath()
+}
+
+// ParseFlags 解析启动参数，第一个参数为 config 时执行配置子命令后退出
+func ParseFlags(name string) *ConfigFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, configUsage, name) }
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfigCommand(name, args[1:]))
+	}
+
+	flags := BindConfigFlags(fs)
+	fs.Parse(args)
+	return flags
+}
+
+// runConfigCommand 执行配置子命令，返回进程退出码
+func runConfigCommand(name string, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(os.Stderr, configUsage, name)
+		return 2
+	}
+	switch args[0] {
+	case "print":
+		return printConfig(name, args[1:])
+	case "validate":
+		return validateConfig(name, args[1:])
+	}
+	fmt.Fprintf(os.Stderr, configUsage, name)
+	return 2
+}
+
+// validateConfig 校验合并环境变量和命令行参数后的配置
+func validateConfig(name string, args []string) int {
+	fs := flag.NewFlagSet(name+" config validate", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, configUsage, name) }
+	flags := BindConfigFlags(fs)
+	fs.Parse(args)
+
+	cfg, err := config.Load(flags.Path(), flags.Overrides)
+	if err == nil {
+		err = service.CheckConfig(cfg)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("配置校验通过: %s\n", flags.Path())
+	return 0
+}
+
+// printConfig 输出配置，密钥以 ****** 代替
+func printConfig(name string, args []string) int {
+	fs := flag.NewFlagSet(name+" config print", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintf(os.Stderr, configUsage, name) }
+	effective := fs.Bool("effective", false, "输出合并环境变量和命令行参数后实际生效的配置")
+	flags := BindConfigFlags(fs)
+	fs.Parse(args)
+
+	var cfg *config.Config
+	var err error
+	if *effective {
+		cfg, err = config.ReadEffective(flags.Path(), flags.Overrides)
+	} else {
+		cfg, err = config.ReadFile(flags.Path())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取配置失败: %v\n", err)
+		return 1
+	}
+
+	data, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "输出配置失败: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(data)
+	return 0
+}
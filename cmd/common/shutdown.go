@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"cdr/config"
+	"cdr/service"
+)
+
+// ClosePusher 关闭推送器并输出推送结果汇总，关闭时等待已提交的推送完成
+//
+// 超过 shutdown.push_timeout 仍未完成的推送和等待重试的推送保留在持久化队列中，下次启动后继续投递。
+func ClosePusher(cfg *config.Config, pusher *service.Pusher) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.PushTimeout)*time.Second)
+	defer cancel()
+	if err := pusher.Close(ctx); err != nil {
+		log.Printf("关闭推送器失败: %v", err)
+	}
+
+	summary := pusher.Summary()
+	log.Printf("推送汇总: 投递成功%d条，放弃%d条（已转入死信），未完成%d条（保留在持久化队列中）",
+		summary.Delivered, summary.Abandoned, summary.Pending)
+}
+
+// ShutdownAdmin 关闭管理服务，最多等待5秒
+func ShutdownAdmin(admin *service.AdminServer) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := admin.Shutdown(ctx); err != nil {
+		log.Printf("关闭管理服务失败: %v", err)
+	}
+}
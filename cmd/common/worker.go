@@ -1,11 +1,14 @@
 package common
 
 import (
+	"context"
 	"sync"
 )
 
-// StartWorkerPool 启动工作池，处理通用的工作任务
-func StartWorkerPool(workers int, handler func() error) {
+// StartWorkerPool 启动工作池，处理通用的工作任务，ctx取消后停止分发并等待进行中的任务完成
+//
+// wait 在每次分发任务前调用，用于限速或暂停，为nil时工作协程空闲即执行。
+func StartWorkerPool(ctx context.Context, workers int, wait func(ctx context.Context) error, handler func() error) {
 	workerChan := make(chan struct{}, workers)
 	var wg sync.WaitGroup
 	wg.Add(workers)
@@ -23,10 +26,22 @@ func StartWorkerPool(workers int, handler func() error) {
 		}()
 	}
 
-	// 持续填充工作通道
+	defer func() {
+		close(workerChan)
+		wg.Wait()
+	}()
+
+	// 按速率持续填充工作通道
 	for {
-		for range make([]struct{}, workers) {
-			workerChan <- struct{}{}
+		if wait != nil {
+			if err := wait(ctx); err != nil {
+				return
+			}
+		}
+		select {
+		case workerChan <- struct{}{}:
+		case <-ctx.Done():
+			return
 		}
 	}
 }
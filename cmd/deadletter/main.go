@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"cdr/cmd/common"
+	"cdr/config"
+	"cdr/service"
+)
+
+const usage = `死信管理工具
+
+用法:
+  deadletter <命令> [选项]
+
+命令:
+  list     列出死信
+  show     显示死信详情（包括每次尝试的状态码）
+  purge    删除死信
+  requeue  将死信放回推送服务的投递队列，按正常的限速、熔断和重试计划重新投递
+
+选项:
+  -id        死信ID
+  -callid    呼叫ID
+  -account   账号ID
+  -endpoint  推送地址包含的子串
+  -from      放弃时间不早于，格式 2006-01-02 15:04:05 或 RFC3339
+  -to        放弃时间不晚于，格式同上
+  -all       purge/requeue 时不指定条件，处理全部死信
+  -config    配置文件路径，未指定时使用环境变量 CDR_CONFIG_PATH
+
+只使用配置中的 retry.dead_letter_dir 和 retry.store_dir，配置项可以通过 -<配置项> 值 或 CDR_ 环境变量覆盖，
+如 -retry.dead_letter_dir /data/dead、CDR_RETRY_STORE_DIR。
+
+requeue 写入 retry.store_dir 下的 requeue 目录，运行中的推送服务在几秒内接收，
+推送服务未运行时在下次启动后接收。重新投递仍然失败的推送按重试计划用尽后再次转入死信。
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	id := flags.String("id", "", "死信ID")
+	callID := flags.String("callid", "", "呼叫ID")
+	account := flags.String("account", "", "账号ID")
+	endpoint := flags.String("endpoint", "", "推送地址包含的子串")
+	from := flags.String("from", "", "放弃时间不早于")
+	to := flags.String("to", "", "放弃时间不晚于")
+	all := flags.Bool("all", false, "处理全部死信")
+	cfgFlags := common.BindConfigFlags(flags)
+	flags.Parse(os.Args[2:])
+
+	filter := service.DeadLetterFilter{ID: *id, CallID: *callID, Account: *account, Endpoint: *endpoint}
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		log.Fatalf("解析 -from 失败: %v", err)
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		log.Fatalf("解析 -to 失败: %v", err)
+	}
+	if (command == "purge" || command == "requeue") && filter == (service.DeadLetterFilter{}) && !*all {
+		log.Fatalf("%s 需要指定过滤条件或 -all", command)
+	}
+
+	// 只需要其中的目录配置，不要求推送配置完整有效
+	cfg, err := config.ReadEffective(cfgFlags.Path(), cfgFlags.Overrides)
+	if cfg == nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	if err != nil {
+		log.Printf("配置存在问题，仅使用其中的目录配置: %v", err)
+	}
+	store, err := service.NewDeadLetterStore(cfg.Retry.DeadLetterDir)
+	if err != nil {
+		log.Fatalf("打开死信存储失败: %v", err)
+	}
+
+	switch command {
+	case "list":
+		err = list(store, filter)
+	case "show":
+		err = show(store, filter)
+	case "purge":
+		err = purge(store, filter)
+	case "requeue":
+		err = requeue(cfg, store, filter)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseTime 解析命令行中的时间
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+}
+
+// list 每条死信输出一行摘要
+func list(store *service.DeadLetterStore, filter service.DeadLetterFilter) error {
+	letters, err := store.List(filter)
+	if err != nil {
+		return err
+	}
+	for _, dl := range letters {
+		fmt.Printf("%s  %s  %-6s  %s  %s  尝试%d次  %s  %s\n",
+			dl.DeadAt.Format("2006-01-02 15:04:05"), dl.ID, dl.Kind, dl.Account, dl.CallID, dl.Attempt, dl.URL, dl.LastError)
+	}
+	fmt.Printf("共%d条死信\n", len(letters))
+	return nil
+}
+
+// show 输出死信的完整内容
+func show(store *service.DeadLetterStore, filter service.DeadLetterFilter) error {
+	letters, err := store.List(filter)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	for _, dl := range letters {
+		if err := encoder.Encode(dl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purge 删除死信
+func purge(store *service.DeadLetterStore, filter service.DeadLetterFilter) error {
+	removed, err := store.Remove(filter)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("已删除%d条死信\n", removed)
+	return nil
+}
+
+// requeue 将死信写回推送服务的投递队列，已尝试次数清零，写入后删除这些死信
+func requeue(cfg *config.Config, store *service.DeadLetterStore, filter service.DeadLetterFilter) error {
+	letters, err := store.List(filter)
+	if err != nil {
+		return err
+	}
+	if len(letters) == 0 {
+		fmt.Println("没有满足条件的死信")
+		return nil
+	}
+
+	deliveries := make([]*service.Delivery, len(letters))
+	for i, dl := range letters {
+		deliveries[i] = dl.Delivery
+	}
+	// 先写入再删除，中途失败时死信可能重复投递，但不会丢失
+	if err := service.WriteRequeue(cfg.Retry.StoreDir, deliveries); err != nil {
+		return err
+	}
+	if _, err := store.RemoveLetters(letters); err != nil {
+		return fmt.Errorf("已放回投递队列，但删除死信失败: %v", err)
+	}
+	fmt.Printf("已将%d条死信放回投递队列 %s\n", len(letters), cfg.Retry.StoreDir)
+	return nil
+}
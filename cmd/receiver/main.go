@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cdr/receiver"
+)
+
+const usage = `模拟推送接收方，用于本地联调和测试
+
+用法:
+  receiver [选项]
+
+选项:
+  -listen        监听地址，默认 :8081
+  -cdr-path      CDR推送路径，默认 /callback/v1/record
+  -status-path   状态推送路径，默认 /callback/v1/status
+  -secret        签名密钥，配置后校验 X-Signature，签名错误返回401
+  -max-events    最多保存的事件数，默认 100000
+  -cert, -key    同时配置证书和私钥后使用HTTPS
+
+故障注入（运行中可以通过 PUT /receiver/faults 修改）:
+  -latency       每个请求的固定延迟（毫秒）
+  -jitter        随机增加0到该值的延迟（毫秒）
+  -reset-rate    直接重置连接的请求比例（%%）
+  -timeout-rate  不响应的请求比例（%%），直到推送方超时断开
+  -hang          超时注入最长的等待时间（秒），之后返回504，默认300
+  -error-rate    返回错误状态码的请求比例（%%）
+  -error-codes   随机选择的错误状态码，如 500,503，默认500
+  -retry-after   返回429和503时附带的 Retry-After（秒）
+  -fault-kinds   故障注入生效的接口，如 cdr 或 cdr,status，默认两个接口都生效
+
+查询接口:
+  GET    /receiver/events  查询收到的事件，参数 kind、accountId、callId、subscriptionId、eventType、valid、after、limit
+  DELETE /receiver/events  清空事件
+  GET    /receiver/stats   各接口的请求、接收、拒绝和故障注入统计
+  GET    /receiver/faults  当前的故障注入配置
+  PUT    /receiver/faults  替换故障注入配置，如 {"errorRate": 20, "errorCodes": [500, 503]}
+`
+
+func main() {
+	flags := flag.NewFlagSet("receiver", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprintf(os.Stderr, usage) }
+	listen := flags.String("listen", ":8081", "监听地址")
+	cdrPath := flags.String("cdr-path", "/callback/v1/record", "CDR推送路径")
+	statusPath := flags.String("status-path", "/callback/v1/status", "状态推送路径")
+	secret := flags.String("secret", "", "签名密钥")
+	maxEvents := flags.Int("max-events", 100000, "最多保存的事件数")
+	certFile := flags.String("cert", "", "服务端证书（PEM）")
+	keyFile := flags.String("key", "", "服务端私钥（PEM）")
+	latency := flags.Int("latency", 0, "固定延迟（毫秒）")
+	jitter := flags.Int("jitter", 0, "随机延迟（毫秒）")
+	resetRate := flags.Float64("reset-rate", 0, "重置连接的比例（%）")
+	timeoutRate := flags.Float64("timeout-rate", 0, "不响应的比例（%）")
+	hang := flags.Int("hang", 300, "超时注入最长的等待时间（秒）")
+	errorRate := flags.Float64("error-rate", 0, "返回错误状态码的比例（%）")
+	errorCodes := flags.String("error-codes", "", "错误状态码，逗号分隔")
+	retryAfter := flags.Int("retry-after", 0, "Retry-After（秒）")
+	faultKinds := flags.String("fault-kinds", "", "故障注入生效的接口，逗号分隔")
+	flags.Parse(os.Args[1:])
+
+	if *maxEvents <= 0 {
+		log.Fatalf("-max-events 必须大于0")
+	}
+	codes, err := parseCodes(*errorCodes)
+	if err != nil {
+		log.Fatalf("解析 -error-codes 失败: %v", err)
+	}
+	var kinds []string
+	if *faultKinds != "" {
+		kinds = strings.Split(*faultKinds, ",")
+	}
+
+	server, err := receiver.New(receiver.Options{
+		CDRPath:    *cdrPath,
+		StatusPath: *statusPath,
+		Secret:     *secret,
+		MaxEvents:  *maxEvents,
+		Faults: receiver.Faults{
+			LatencyMs:   *latency,
+			JitterMs:    *jitter,
+			ResetRate:   *resetRate,
+			TimeoutRate: *timeoutRate,
+			HangSec:     *hang,
+			ErrorRate:   *errorRate,
+			ErrorCodes:  codes,
+			RetryAfter:  *retryAfter,
+			Kinds:       kinds,
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           server.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+	go func() {
+		var err error
+		if *certFile != "" && *keyFile != "" {
+			log.Printf("模拟接收方已启动 https://%s，CDR: %s，状态: %s", *listen, *cdrPath, *statusPath)
+			err = httpServer.ListenAndServeTLS(*certFile, *keyFile)
+		} else {
+			log.Printf("模拟接收方已启动 http://%s，CDR: %s，状态: %s", *listen, *cdrPath, *statusPath)
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("模拟接收方异常退出: %v", err)
+		}
+	}()
+
+	// 收到SIGINT/SIGTERM后停止接收，超时注入中的请求不等待
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		httpServer.Close()
+	}
+	log.Println("模拟接收方已退出")
+}
+
+// parseCodes 解析逗号分隔的状态码
+func parseCodes(value string) ([]int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var codes []int
+	for _, s := range strings.Split(value, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"cdr/cmd/common"
 	"cdr/config"
@@ -10,45 +15,103 @@ import (
 )
 
 func main() {
+	// 解析命令行参数，config 子命令执行后直接退出
+	flags := common.ParseFlags("status")
+
 	log.Println("呼叫状态推送系统启动...")
 
 	// 加载配置
-	cfg, err := config.LoadConfig(config.GetConfigPath())
+	configPath := flags.Path()
+	cfg, err := config.Load(configPath, flags.Overrides)
 	if err != nil {
 		log.Printf("加载配置失败: %v", err)
 		os.Exit(1)
 	}
 
+	// 初始化推送器，未完成的推送保存在持久化队列中
+	pusher, err := service.NewPusher(cfg, "status")
+	if err != nil {
+		log.Printf("初始化推送器失败: %v", err)
+		os.Exit(1)
+	}
+
 	// 初始化服务
-	cdrService, err := service.NewCDRService(cfg)
+	cdrService, err := service.NewCDRService(cfg, pusher)
 	if err != nil {
 		log.Printf("初始化CDR服务失败: %v", err)
 		os.Exit(1)
 	}
-	callStatusService := service.NewCallStatusService(cfg, cdrService)
+	callStatusService, err := service.NewCallStatusService(cfg, cdrService, pusher)
+	if err != nil {
+		log.Printf("初始化呼叫状态服务失败: %v", err)
+		os.Exit(1)
+	}
+
+	// 初始化并启动管理服务
+	admin := service.NewAdminServer(cfg, cfg.Admin.StatusListen)
+	health := service.NewHealthService(cfg, callStatusService, cdrService, pusher)
+	health.RegisterHandlers(admin.Mux())
+	api := service.NewAdminAPI(cfg, callStatusService, cdrService, pusher)
+	api.RegisterHandlers(admin.Mux())
+	admin.Start()
+
+	// 继续投递上次退出时未完成的推送
+	pusher.Resume()
 
-	// 初始化并启动健康检查服务
-	healthService := service.NewHealthService(cfg, callStatusService)
+	// 推进现有呼叫的状态，结束的呼叫会同时推送话单，退出时等待通话结束后再停止
+	lifecycleCtx, stopLifecycle := context.WithCancel(context.Background())
+	lifecycleDone := make(chan struct{})
 	go func() {
-		if err := healthService.StartHealthServer("9090"); err != nil {
-			log.Printf("启动健康检查服务失败: %v", err)
-		}
+		defer close(lifecycleDone)
+		callStatusService.Run(lifecycleCtx)
 	}()
 
-	// 使用通用工作池处理呼叫状态更新
-	common.StartWorkerPool(cfg.Push.Workers, func() error {
-		// 先创建新呼叫
-		if err := callStatusService.StartNewCall(); err != nil {
-			log.Printf("创建新呼叫失败: %v", err)
-			return err
-		}
+	// 收到SIGINT/SIGTERM后停止，SIGHUP用于重新加载配置
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	// 配置文件修改或收到SIGHUP时重新加载
+	reloader := service.NewConfigReloader(configPath, flags.Overrides, cfg, pusher, cdrService, callStatusService, health)
+	reloaderDone := make(chan struct{})
+	go func() {
+		defer close(reloaderDone)
+		reloader.Run(ctx)
+	}()
 
-		// 然后更新现有呼叫的状态
-		if err := callStatusService.UpdateCallStatus(); err != nil {
-			log.Printf("更新呼叫状态失败: %v", err)
+	// 使用通用工作池按流量曲线创建新呼叫，达到并发上限时跳过，收到退出信号后停止
+	// 已提交的推送不随退出信号取消，未完成的保留在持久化队列中
+	pushCtx := context.WithoutCancel(ctx)
+	common.StartWorkerPool(ctx, cfg.Push.Workers, callStatusService.Load().Wait, func() error {
+		if err := callStatusService.StartNewCall(pushCtx); err != nil && !errors.Is(err, service.ErrTooManyCalls) {
+			log.Printf("创建新呼叫失败: %v", err)
 			return err
 		}
 		return nil
 	})
-}
+	stop() // 再次收到信号时直接退出
 
+	// 先停止重新加载和修改运行参数的管理接口，之后不会再有新的呼叫、推送或配置修改
+	<-reloaderDone
+	api.Stop()
+	cfg = reloader.Current()
+
+	// 已停止新建呼叫，等待进行中的通话结束，超时后强制结束
+	log.Printf("收到退出信号，停止新建呼叫，等待%d个进行中的通话结束", callStatusService.ActiveCalls())
+	drainCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Shutdown.CallTimeout)*time.Second)
+	if forced := callStatusService.Drain(drainCtx); forced > 0 {
+		log.Printf("等待超时，强制结束%d个通话", forced)
+	}
+	cancel()
+	stopLifecycle()
+	<-lifecycleDone
+
+	// 管理接口在推送器关闭前停止，避免请求访问已关闭的推送器
+	common.ShutdownAdmin(admin)
+	common.ClosePusher(cfg, pusher)
+	if err := callStatusService.Close(); err != nil {
+		log.Printf("关闭状态推送日志失败: %v", err)
+	}
+	if err := cdrService.Close(); err != nil {
+		log.Printf("关闭CDR推送日志失败: %v", err)
+	}
+	log.Println("呼叫状态推送系统已退出")
+}
@@ -0,0 +1,75 @@
+package config
+
+// AccountConfig 一个租户账号，未单独配置的推送地址和重试计划使用 push 和 retry 中的配置
+type AccountConfig struct {
+	ID          string `yaml:"id"`
+	ServiceType int    `yaml:"service_type"`
+	Secret      string `yaml:"secret"` // 推送签名密钥，为空时不签名
+	Weight      int    `yaml:"weight"` // 新建呼叫和生成CDR的流量占比权重，未配置时为1
+
+	CdrURL    string `yaml:"cdr_url"`
+	StatusURL string `yaml:"status_url"`
+
+	Retry struct {
+		Times  int   `yaml:"times"`
+		Delays []int `yaml:"delays"`
+	} `yaml:"retry"`
+}
+
+// legacyAccount 由 account 和全局推送地址生成的单个账号，用于未配置 accounts 的配置文件
+func (c *Config) legacyAccount() AccountConfig {
+	return AccountConfig{
+		ID:          c.Account.ID,
+		ServiceType: c.Account.ServiceType,
+		Secret:      c.Account.Secret,
+		Weight:      1,
+	}
+}
+
+// FindAccount 按ID查找账号，不存在时返回nil
+func (c *Config) FindAccount(id string) *AccountConfig {
+	for i := range c.Accounts {
+		if c.Accounts[i].ID == id {
+			return &c.Accounts[i]
+		}
+	}
+	return nil
+}
+
+// CdrURLFor 返回账号的CDR推送地址，account 为nil或未单独配置时使用 push.cdr_url
+func (c *Config) CdrURLFor(account *AccountConfig) string {
+	if account != nil && account.CdrURL != "" {
+		return account.CdrURL
+	}
+	return c.Push.CdrURL
+}
+
+// StatusURLFor 返回账号的状态推送地址，account 为nil或未单独配置时使用 push.status_url
+func (c *Config) StatusURLFor(account *AccountConfig) string {
+	if account != nil && account.StatusURL != "" {
+		return account.StatusURL
+	}
+	return c.Push.StatusURL
+}
+
+// RetryFor 返回账号的最大尝试次数和重试间隔，未单独配置的部分使用 retry 中的配置
+func (c *Config) RetryFor(account *AccountConfig) (times int, delays []int) {
+	times, delays = c.Retry.Times, c.Retry.Delays
+	if account != nil {
+		if account.Retry.Times > 0 {
+			times = account.Retry.Times
+		}
+		if len(account.Retry.Delays) > 0 {
+			delays = account.Retry.Delays
+		}
+	}
+	return times, delays
+}
+
+// SecretFor 返回账号的签名密钥，account 为nil时使用 account.secret
+func (c *Config) SecretFor(account *AccountConfig) string {
+	if account != nil {
+		return account.Secret
+	}
+	return c.Account.Secret
+}
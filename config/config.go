@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,27 +15,226 @@ type Config struct {
 		CdrURL    string `yaml:"cdr_url"`
 		StatusURL string `yaml:"status_url"`
 		Workers   int    `yaml:"workers"` // 并发推送的工作协程数量
+
+		// CheckBodyCode 2xx响应体为 {"code": ...} 时，code不为0视为失败
+		CheckBodyCode bool `yaml:"check_body_code"`
+
+		// 按推送地址单独设置的读取超时（秒），为0时使用 http.read_timeout
+		CdrTimeout    int `yaml:"cdr_timeout"`
+		StatusTimeout int `yaml:"status_timeout"`
+
+		// HTTP 推送使用的HTTP客户端配置，CDR与状态推送共用
+		HTTP struct {
+			CAFile              string `yaml:"ca_file"`                 // 自定义CA证书（PEM）
+			CertFile            string `yaml:"cert_file"`               // 双向TLS客户端证书（PEM）
+			KeyFile             string `yaml:"key_file"`                // 双向TLS客户端私钥（PEM）
+			TLSMinVersion       string `yaml:"tls_min_version"`         // 最低TLS版本：1.0、1.1、1.2、1.3
+			ConnectTimeout      int    `yaml:"connect_timeout"`         // 建立连接（含TLS握手）超时（秒）
+			ReadTimeout         int    `yaml:"read_timeout"`            // 等待响应超时（秒）
+			KeepAlive           int    `yaml:"keep_alive"`              // TCP保活间隔（秒），为负数时关闭连接复用
+			MaxIdleConnsPerHost int    `yaml:"max_idle_conns_per_host"` // 每个主机保留的最大空闲连接数
+		} `yaml:"http"`
+
+		// Batch CDR批量推送配置，开启后多条CDR合并为一个请求
+		Batch struct {
+			Enabled  bool   `yaml:"enabled"`
+			MaxCount int    `yaml:"max_count"` // 每批最多条数
+			MaxBytes int    `yaml:"max_bytes"` // 每批最大字节数
+			LingerMs int    `yaml:"linger_ms"` // 等待凑批的最长时间（毫秒）
+			Format   string `yaml:"format"`    // 请求体格式：json（数组）或 ndjson
+		} `yaml:"batch"`
+
+		// CircuitBreaker 按推送地址熔断，打开期间新的投递直接进入重试队列，修改需要重启
+		CircuitBreaker struct {
+			Enabled        bool `yaml:"enabled"`
+			Window         int  `yaml:"window"`           // 统计失败率的最近请求数
+			MinRequests    int  `yaml:"min_requests"`     // 窗口内至少多少次请求才判断失败率
+			FailureRate    int  `yaml:"failure_rate"`     // 打开熔断的失败率（%）
+			OpenDuration   int  `yaml:"open_duration"`    // 打开后多久进入半开状态（秒）
+			HalfOpenProbes int  `yaml:"half_open_probes"` // 半开状态下放行的探测请求数
+		} `yaml:"circuit_breaker"`
 	} `yaml:"push"`
 
+	// Account 单账号配置，未配置 accounts 时作为唯一的账号
 	Account struct {
 		ID          string `yaml:"id"`
 		ServiceType int    `yaml:"service_type"`
+		Secret      string `yaml:"secret"` // 推送签名密钥，为空时不签名
 	} `yaml:"account"`
 
+	// Accounts 多租户配置，新建的呼叫和CDR按权重分配到各账号，配置后忽略 account
+	Accounts []AccountConfig `yaml:"accounts"`
+
+	// Subscriptions 状态事件订阅，配置后状态事件只推送给匹配的订阅，不再使用 status_url
+	Subscriptions []SubscriptionConfig `yaml:"subscriptions"`
+
 	Retry struct {
-		Times  int   `yaml:"times"`
-		Delays []int `yaml:"delays"`
+		Times         int    `yaml:"times"`
+		Delays        []int  `yaml:"delays"`
+		StoreDir      string `yaml:"store_dir"`       // 待投递推送的持久化目录
+		DeadLetterDir string `yaml:"dead_letter_dir"` // 重试用尽的推送（死信）存放目录
+
+		NonRetryableCodes []int `yaml:"non_retryable_codes"` // 不重试、直接放弃的状态码
+		RetryAfterCodes   []int `yaml:"retry_after_codes"`   // 按 Retry-After 响应头决定重试间隔的状态码
+		MaxRetryAfter     int   `yaml:"max_retry_after"`     // Retry-After 的上限（秒）
 	} `yaml:"retry"`
 
+	// Rate 速率限制（每秒），为0时不限速
+	Rate struct {
+		NewCall float64 `yaml:"new_call"` // 每秒新建呼叫数
+		CDR     float64 `yaml:"cdr"`      // 每秒推送的CDR条数，所有CDR推送地址合计
+		Status  float64 `yaml:"status"`   // 每秒推送的状态事件数，所有状态推送地址合计
+		Burst   int     `yaml:"burst"`    // 允许的突发数量
+
+		// Endpoints 按推送地址限制每秒请求数，批量推送时一批计为一次请求
+		Endpoints map[string]float64 `yaml:"endpoints"`
+	} `yaml:"rate"`
+
+	// Load 流量曲线，驱动状态推送进程的新建呼叫和CDR推送进程的CDR生成（每秒）
+	// 未配置 profile 时分别按 rate.new_call 和 rate.cdr 恒定速率；曲线中的速率必须大于0，0只在 rate 中表示不限速
+	Load struct {
+		Profile string `yaml:"profile"` // ramp、step、spike、diurnal
+
+		// Ramp 在duration秒内从from线性变化到to，之后保持to
+		Ramp struct {
+			From     float64 `yaml:"from"`
+			To       float64 `yaml:"to"`
+			Duration int     `yaml:"duration"`
+		} `yaml:"ramp"`
+
+		// Steps 依次执行的阶段，全部结束后保持最后一个阶段的速率（repeat为true时循环）
+		Steps []struct {
+			Rate     float64 `yaml:"rate"`
+			Duration int     `yaml:"duration"` // 阶段持续时间（秒）
+		} `yaml:"steps"`
+		Repeat bool `yaml:"repeat"`
+
+		// Spike 每interval秒的最后duration秒从base突增到peak
+		Spike struct {
+			Base     float64 `yaml:"base"`
+			Peak     float64 `yaml:"peak"`
+			Interval int     `yaml:"interval"`
+			Duration int     `yaml:"duration"`
+		} `yaml:"spike"`
+
+		// Diurnal 24小时话务曲线压缩到minutes分钟，速率在min和max之间按hourly变化
+		Diurnal struct {
+			Min     float64   `yaml:"min"`
+			Max     float64   `yaml:"max"`
+			Minutes int       `yaml:"minutes"`
+			Hourly  []float64 `yaml:"hourly"` // 0-23点相对最高峰的比例（0~1），未配置时使用内置曲线
+		} `yaml:"diurnal"`
+	} `yaml:"load"`
+
+	// Interval 已废弃，未配置 rate 时按间隔（秒）换算为速率
 	Interval struct {
 		CDR     int `yaml:"cdr"`
 		Status  int `yaml:"status"`
 		NewCall int `yaml:"new_call"`
 	} `yaml:"interval"`
+
+	// Admin 管理服务（健康检查、指标、运行时控制），配置证书后使用HTTPS
+	Admin struct {
+		StatusListen string `yaml:"status_listen"` // 状态推送进程的监听地址，默认只监听本机
+		CDRListen    string `yaml:"cdr_listen"`    // CDR推送进程的监听地址，默认只监听本机
+		CertFile     string `yaml:"cert_file"`     // 服务端证书（PEM）
+		KeyFile      string `yaml:"key_file"`      // 服务端私钥（PEM）
+		Token        string `yaml:"token"`         // 修改运行参数的请求须携带的令牌，为空时管理接口只读
+	} `yaml:"admin"`
+
+	// Health 就绪与存活检查的阈值
+	Health struct {
+		EndpointFailureWindow int `yaml:"endpoint_failure_window"` // 推送地址连续失败超过多久视为未就绪（秒）
+		MaxRetryBacklog       int `yaml:"max_retry_backlog"`       // 等待重试的推送数超过多少视为未就绪
+		StallTimeout          int `yaml:"stall_timeout"`           // 工作循环超过多久没有进展视为卡死（秒）
+	} `yaml:"health"`
+
+	// Shutdown 收到SIGINT/SIGTERM后的退出流程（秒）
+	Shutdown struct {
+		CallTimeout int `yaml:"call_timeout"` // 等待进行中的通话按计划结束的时间，超时后强制结束
+		PushTimeout int `yaml:"push_timeout"` // 等待已提交的推送完成的时间，超时后保留在持久化队列中
+	} `yaml:"shutdown"`
+
+	// Reload 运行中重新加载配置文件，收到SIGHUP时也会重新加载
+	Reload struct {
+		WatchInterval int `yaml:"watch_interval"` // 检查配置文件是否修改的间隔（秒），为负数时只响应SIGHUP
+	} `yaml:"reload"`
+
+	// Simulation 通话模拟配置（秒）
+	Simulation struct {
+		MaxActiveCalls  int `yaml:"max_active_calls"`  // 同时进行中的最大通话数
+		MaxRingDelay    int `yaml:"max_ring_delay"`    // 发起呼叫到振铃的最大间隔
+		MaxAnswerDelay  int `yaml:"max_answer_delay"`  // 振铃到接听的最大间隔
+		MaxTalkDuration int `yaml:"max_talk_duration"` // 最长通话时长
+		NoAnswerTimeout int `yaml:"no_answer_timeout"` // 振铃无人接听的超时时间
+
+		// Outcomes 各通话结局的权重，未配置时全部正常接通
+		Outcomes map[string]int `yaml:"outcomes"`
+	} `yaml:"simulation"`
+
+	// Privacy 隐私号模拟配置，仅对 service_type 为200的账号生效，各账号共用号码池
+	Privacy struct {
+		NumberPoolNo string `yaml:"number_pool_no"` // 号码池编号
+		XNumbers     int    `yaml:"x_numbers"`      // X号码数量
+		AXRatio      int    `yaml:"ax_ratio"`       // AX绑定占比（%），其余为AXB绑定
+		BindingTTL   int    `yaml:"binding_ttl"`    // 绑定有效期（秒）
+		RebindDelay  int    `yaml:"rebind_delay"`   // 绑定过期后重新绑定的间隔（秒）
+	} `yaml:"privacy"`
 }
 
-// LoadConfig 从YAML文件加载配置
+// LoadConfig 从YAML文件加载配置，CDR_ 环境变量优先于配置文件
 func LoadConfig(configPath string) (*Config, error) {
+	return Load(configPath, nil)
+}
+
+// Load 加载配置并校验，优先级从高到低为命令行参数、CDR_ 环境变量、配置文件、默认值
+//
+// 校验失败时返回 *ValidationError，包含全部问题及其所在行号。
+func Load(configPath string, flags Overrides) (*Config, error) {
+	doc, err := readConfig(configPath, flags, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 验证必要的配置项
+	if err := doc.validate(); err != nil {
+		return nil, err
+	}
+
+	return doc.cfg, nil
+}
+
+// ReadFile 只读取配置文件并填充默认值，不应用环境变量和命令行参数，也不校验取值
+func ReadFile(configPath string) (*Config, error) {
+	doc, err := readConfig(configPath, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return doc.cfg, doc.parseError()
+}
+
+// ReadEffective 读取配置文件，应用环境变量和命令行参数并填充默认值，不校验取值
+func ReadEffective(configPath string, flags Overrides) (*Config, error) {
+	doc, err := readConfig(configPath, flags, true)
+	if err != nil {
+		return nil, err
+	}
+	return doc.cfg, doc.parseError()
+}
+
+// document 读取后尚未校验的配置
+type document struct {
+	cfg      *Config
+	lines    map[string]int    // 配置项在配置文件中的行号
+	sources  map[string]string // 被环境变量或命令行参数覆盖的配置项及其来源
+	problems []Problem         // 解析时发现的问题：未知配置项、取值类型错误
+	legacy   bool              // 未配置 accounts，账号由 account 生成
+}
+
+// readConfig 读取配置文件，overrides 为true时应用环境变量和命令行参数 flags，最后填充默认值
+//
+// 未知配置项和取值类型错误记录在 problems 中，与校验发现的问题一起报告。
+func readConfig(configPath string, flags Overrides, overrides bool) (*document, error) {
 	if configPath == "" {
 		configPath = "config/config.yaml"
 	}
@@ -45,34 +245,167 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("读取配置文件失败: %v", err)
 	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %v", err)
 	}
+	doc := &document{
+		cfg:     &Config{},
+		lines:   make(map[string]int),
+		sources: make(map[string]string),
+	}
+	if root.Kind != 0 { // 空文件
+		doc.walk(&root, reflect.TypeOf(Config{}), "")
+		if err := root.Decode(doc.cfg); err != nil {
+			doc.addDecodeError(err)
+		}
+	}
 
-	// 验证必要的配置项
-	if err := cfg.validate(); err != nil {
-		return nil, err
+	if overrides {
+		doc.applyOverrides(flags)
 	}
 
-	return &cfg, nil
+	// 填充默认值
+	doc.legacy = len(doc.cfg.Accounts) == 0
+	doc.cfg.setDefaults()
+	return doc, nil
 }
 
-// validate 验证配置是否完整
-func (c *Config) validate() error {
-	if c.Push.CdrURL == "" {
-		return fmt.Errorf("CDR推送地址未配置")
+// setDefaults 为未配置的可选项填充默认值
+func (c *Config) setDefaults() {
+	if len(c.Accounts) == 0 {
+		c.Accounts = []AccountConfig{c.legacyAccount()}
+	}
+	for i := range c.Accounts {
+		if c.Accounts[i].Weight == 0 {
+			c.Accounts[i].Weight = 1
+		}
+	}
+	for i := range c.Subscriptions {
+		if c.Subscriptions[i].MessageType == 0 {
+			c.Subscriptions[i].MessageType = 1
+		}
+	}
+	if c.Push.HTTP.ConnectTimeout <= 0 {
+		c.Push.HTTP.ConnectTimeout = 5
+	}
+	if c.Push.HTTP.ReadTimeout <= 0 {
+		c.Push.HTTP.ReadTimeout = 10
+	}
+	if c.Push.HTTP.KeepAlive == 0 {
+		c.Push.HTTP.KeepAlive = 30
+	}
+	if c.Push.HTTP.MaxIdleConnsPerHost <= 0 {
+		c.Push.HTTP.MaxIdleConnsPerHost = c.Push.Workers
+	}
+	if c.Push.Batch.MaxCount <= 0 {
+		c.Push.Batch.MaxCount = 100
+	}
+	if c.Push.Batch.MaxBytes <= 0 {
+		c.Push.Batch.MaxBytes = 1 << 20
+	}
+	if c.Push.Batch.LingerMs <= 0 {
+		c.Push.Batch.LingerMs = 200
+	}
+	if c.Push.Batch.Format == "" {
+		c.Push.Batch.Format = "json"
+	}
+	if c.Rate.NewCall == 0 && c.Interval.NewCall > 0 {
+		c.Rate.NewCall = 1 / float64(c.Interval.NewCall)
+	}
+	if c.Rate.CDR == 0 && c.Interval.CDR > 0 {
+		c.Rate.CDR = 1 / float64(c.Interval.CDR)
+	}
+	if c.Rate.Status == 0 && c.Interval.Status > 0 {
+		c.Rate.Status = 1 / float64(c.Interval.Status)
+	}
+	if c.Rate.Burst <= 0 {
+		c.Rate.Burst = 1
+	}
+	if c.Admin.StatusListen == "" {
+		c.Admin.StatusListen = "127.0.0.1:9090"
+	}
+	if c.Admin.CDRListen == "" {
+		c.Admin.CDRListen = "127.0.0.1:9091"
+	}
+	if c.Shutdown.CallTimeout <= 0 {
+		c.Shutdown.CallTimeout = 30
+	}
+	if c.Shutdown.PushTimeout <= 0 {
+		c.Shutdown.PushTimeout = 10
+	}
+	if c.Reload.WatchInterval == 0 {
+		c.Reload.WatchInterval = 2
+	}
+	if c.Health.EndpointFailureWindow <= 0 {
+		c.Health.EndpointFailureWindow = 60
+	}
+	if c.Health.MaxRetryBacklog <= 0 {
+		c.Health.MaxRetryBacklog = 10000
+	}
+	if c.Health.StallTimeout <= 0 {
+		c.Health.StallTimeout = 60
+	}
+	if c.Push.CircuitBreaker.Window <= 0 {
+		c.Push.CircuitBreaker.Window = 20
+	}
+	if c.Push.CircuitBreaker.MinRequests <= 0 {
+		c.Push.CircuitBreaker.MinRequests = 10
+	}
+	if c.Push.CircuitBreaker.FailureRate <= 0 {
+		c.Push.CircuitBreaker.FailureRate = 50
+	}
+	if c.Push.CircuitBreaker.OpenDuration <= 0 {
+		c.Push.CircuitBreaker.OpenDuration = 30
+	}
+	if c.Push.CircuitBreaker.HalfOpenProbes <= 0 {
+		c.Push.CircuitBreaker.HalfOpenProbes = 3
+	}
+	if c.Retry.StoreDir == "" {
+		c.Retry.StoreDir = filepath.Join("data", "outbox")
+	}
+	if c.Retry.DeadLetterDir == "" {
+		c.Retry.DeadLetterDir = filepath.Join("data", "deadletter")
+	}
+	if c.Retry.NonRetryableCodes == nil {
+		c.Retry.NonRetryableCodes = []int{400, 401, 404, 422}
+	}
+	if c.Retry.RetryAfterCodes == nil {
+		c.Retry.RetryAfterCodes = []int{429, 503}
+	}
+	if c.Retry.MaxRetryAfter <= 0 {
+		c.Retry.MaxRetryAfter = 3600
+	}
+	if c.Simulation.MaxActiveCalls <= 0 {
+		c.Simulation.MaxActiveCalls = 10000
+	}
+	if c.Simulation.MaxRingDelay <= 0 {
+		c.Simulation.MaxRingDelay = 3
+	}
+	if c.Simulation.MaxAnswerDelay <= 0 {
+		c.Simulation.MaxAnswerDelay = 10
+	}
+	if c.Simulation.MaxTalkDuration <= 0 {
+		c.Simulation.MaxTalkDuration = 600
+	}
+	if c.Simulation.NoAnswerTimeout <= 0 {
+		c.Simulation.NoAnswerTimeout = 60
+	}
+	if len(c.Simulation.Outcomes) == 0 {
+		c.Simulation.Outcomes = map[string]int{"answered": 1}
+	}
+	if c.Privacy.NumberPoolNo == "" {
+		c.Privacy.NumberPoolNo = "NP0001"
 	}
-	if c.Push.StatusURL == "" {
-		return fmt.Errorf("状态推送地址未配置")
+	if c.Privacy.XNumbers <= 0 {
+		c.Privacy.XNumbers = 100
 	}
-	if c.Account.ID == "" {
-		return fmt.Errorf("账号ID未配置")
+	if c.Privacy.BindingTTL <= 0 {
+		c.Privacy.BindingTTL = 600
 	}
-	if len(c.Retry.Delays) == 0 {
-		return fmt.Errorf("重试间隔未配置")
+	if c.Privacy.RebindDelay <= 0 {
+		c.Privacy.RebindDelay = 60
 	}
-	return nil
 }
 
 // GetConfigPath 获取配置文件路径
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix 覆盖配置项的环境变量前缀
+const EnvPrefix = "CDR_"
+
+// Overrides 通过命令行参数覆盖的配置项，键为配置项的YAML路径，如 push.workers
+type Overrides map[string]string
+
+// field 一个可以单独覆盖的配置项
+type field struct {
+	key   string // YAML路径
+	index []int  // 在 Config 中的字段索引
+	typ   reflect.Type
+}
+
+// configFields 全部配置项，嵌套结构展开为以点分隔的路径
+var configFields = collectFields(reflect.TypeOf(Config{}), "", nil)
+
+func collectFields(t reflect.Type, prefix string, index []int) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+		key := prefix + name
+		fieldIndex := append(append([]int(nil), index...), i)
+		if sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, collectFields(sf.Type, key+".", fieldIndex)...)
+			continue
+		}
+		fields = append(fields, field{key: key, index: fieldIndex, typ: sf.Type})
+	}
+	return fields
+}
+
+// EnvName 返回配置项对应的环境变量名，如 push.cdr_url 对应 CDR_PUSH_CDR_URL
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// BindFlags 为每个配置项注册命令行参数，如 -push.workers 8，返回解析后指定的配置项
+//
+// 列表和映射使用YAML行内格式，如 -retry.delays '[0, 5, 30]'、-simulation.outcomes '{answered: 70, busy: 30}'。
+func BindFlags(fs *flag.FlagSet) Overrides {
+	overrides := make(Overrides)
+	for _, f := range configFields {
+		f := f
+		usage := fmt.Sprintf("覆盖配置项 %s（环境变量 %s）", f.key, EnvName(f.key))
+		fs.Func(f.key, usage, func(value string) error {
+			if err := setValue(reflect.New(f.typ).Elem(), value); err != nil {
+				return err
+			}
+			overrides[f.key] = value
+			return nil
+		})
+	}
+	return overrides
+}
+
+// applyOverrides 按命令行参数、环境变量的优先级覆盖配置文件中的值，并记录取值来源
+func (d *document) applyOverrides(flags Overrides) {
+	v := reflect.ValueOf(d.cfg).Elem()
+	for _, f := range configFields {
+		var value, source string
+		if s, ok := flags[f.key]; ok {
+			value, source = s, "命令行参数 -"+f.key
+		} else if s, ok := os.LookupEnv(EnvName(f.key)); ok {
+			value, source = s, "环境变量 "+EnvName(f.key)
+		} else {
+			continue
+		}
+		d.sources[f.key] = source
+		d.dropProblems(f.key)
+		if err := setValue(v.FieldByIndex(f.index), value); err != nil {
+			d.problems = append(d.problems, Problem{Key: f.key, Source: source, Message: fmt.Sprintf("取值无效: %v", err)})
+		}
+	}
+}
+
+// dropProblems 移除配置文件中已被覆盖的配置项的解析问题
+func (d *document) dropProblems(key string) {
+	problems := d.problems[:0]
+	for _, p := range d.problems {
+		if p.Key != key {
+			problems = append(problems, p)
+		}
+	}
+	d.problems = problems
+}
+
+// setValue 将字符串解析为配置项的类型并赋值，字符串原样使用，其他类型按YAML解析
+func setValue(v reflect.Value, value string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	ptr := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(value), ptr.Interface()); err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+// Redacted 返回隐藏了密钥的配置副本，用于输出
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	v := reflect.ValueOf(&redacted).Elem()
+	for _, f := range configFields {
+		if fv := v.FieldByIndex(f.index); secretKeys[f.key] && fv.String() != "" {
+			fv.SetString("******")
+		}
+	}
+	redacted.Accounts = append([]AccountConfig(nil), c.Accounts...)
+	for i := range redacted.Accounts {
+		if redacted.Accounts[i].Secret != "" {
+			redacted.Accounts[i].Secret = "******"
+		}
+	}
+	return &redacted
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// restartOnly 运行中无法替换、需要重启才能生效的配置项
+var restartOnly = []string{
+	"push.http",
+	"push.batch",
+	"push.circuit_breaker",
+	"retry.store_dir",
+	"retry.dead_letter_dir",
+	"rate.burst",
+	"load",
+	"admin",
+	"privacy",
+	"reload",
+}
+
+// secretKeys 日志中不输出取值的配置项
+var secretKeys = map[string]bool{
+	"account.secret":  true,
+	"accounts.secret": true,
+	"admin.token":     true,
+}
+
+// indexPattern 配置项路径中的列表下标，如 accounts[0].secret 中的 [0]
+var indexPattern = regexp.MustCompile(`\[\d+\]`)
+
+// isSecret 判断配置项是否为密钥，列表元素中的配置项忽略下标
+func isSecret(key string) bool {
+	return secretKeys[indexPattern.ReplaceAllString(key, "")]
+}
+
+// Change 一个配置项的修改
+type Change struct {
+	Key     string // 配置项在YAML中的路径，如 push.workers
+	Old     string
+	New     string
+	Restart bool // 需要重启才能生效，重新加载后仍保持原值
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %s -> %s", c.Key, c.Old, c.New)
+	if c.Restart {
+		s += "（需重启生效）"
+	}
+	return s
+}
+
+// Reload 重新读取配置文件并与当前配置比较，返回新配置和修改项
+//
+// 环境变量和启动时的命令行参数 flags 仍优先于配置文件。新配置校验失败时返回错误和修改项，
+// 调用方应继续使用当前配置。需要重启才能生效的配置项在返回的新配置中保持当前值。
+func Reload(current *Config, configPath string, flags Overrides) (*Config, []Change, error) {
+	doc, err := readConfig(configPath, flags, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 先校验再比较，需要重启才能生效的配置项也要通过校验
+	err = doc.validate()
+	changes := diff("", reflect.ValueOf(current).Elem(), reflect.ValueOf(doc.cfg).Elem())
+	if err != nil {
+		return nil, changes, err
+	}
+	return doc.cfg, changes, nil
+}
+
+// diff 逐个比较配置项，需要重启才能生效的配置项在next中恢复为当前值
+func diff(key string, current, next reflect.Value) []Change {
+	if current.Kind() == reflect.Struct {
+		var changes []Change
+		for i := 0; i < current.NumField(); i++ {
+			name, _, _ := strings.Cut(current.Type().Field(i).Tag.Get("yaml"), ",")
+			if key != "" {
+				name = key + "." + name
+			}
+			changes = append(changes, diff(name, current.Field(i), next.Field(i))...)
+		}
+		return changes
+	}
+
+	// 元素个数不变的结构体列表逐个元素比较，如 accounts[1].weight
+	if current.Kind() == reflect.Slice && current.Type().Elem().Kind() == reflect.Struct && current.Len() == next.Len() {
+		var changes []Change
+		for i := 0; i < current.Len(); i++ {
+			changes = append(changes, diff(fmt.Sprintf("%s[%d]", key, i), current.Index(i), next.Index(i))...)
+		}
+		return changes
+	}
+
+	if reflect.DeepEqual(current.Interface(), next.Interface()) {
+		return nil
+	}
+	change := Change{
+		Key:     key,
+		Old:     formatValue(current),
+		New:     formatValue(next),
+		Restart: isRestartOnly(key),
+	}
+	if isSecret(key) {
+		change.Old, change.New = "******", "******"
+	}
+	if change.Restart {
+		next.Set(current)
+	}
+	return []Change{change}
+}
+
+// formatValue 输出配置项的取值，字符串加引号以区分空值，结构体列表只输出元素个数以免泄露密钥
+func formatValue(v reflect.Value) string {
+	switch {
+	case v.Kind() == reflect.String:
+		return strconv.Quote(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		return fmt.Sprintf("%d项", v.Len())
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func isRestartOnly(key string) bool {
+	for _, prefix := range restartOnly {
+		if key == prefix || strings.HasPrefix(key, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reloadYAML 加载 before 后将配置文件改为 after 并重新加载
+func reloadYAML(t *testing.T, before, after string) (current, next *Config, changes []Change, err error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(before), 0644); err != nil {
+		t.Fatal(err)
+	}
+	current, err = Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load() = %v", err)
+	}
+	if err := os.WriteFile(path, []byte(after), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next, changes, err = Reload(current, path, nil)
+	return current, next, changes, err
+}
+
+func TestReloadRestartOnly(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		key     string
+		restart bool
+		value   func(c *Config) any // 修改的配置项在新配置中的取值
+	}{
+		{
+			name:  "立即生效",
+			yaml:  strings.Replace(validBase, "times: 3", "times: 2", 1),
+			key:   "retry.times",
+			value: func(c *Config) any { return c.Retry.Times },
+		},
+		{
+			name:    "熔断打开时长需要重启",
+			yaml:    strings.Replace(validBase, "  workers: 10\n", "  workers: 10\n  circuit_breaker:\n    open_duration: 5\n", 1),
+			key:     "push.circuit_breaker.open_duration",
+			restart: true,
+			value:   func(c *Config) any { return c.Push.CircuitBreaker.OpenDuration },
+		},
+		{
+			name:    "熔断失败率需要重启",
+			yaml:    strings.Replace(validBase, "  workers: 10\n", "  workers: 10\n  circuit_breaker:\n    failure_rate: 80\n", 1),
+			key:     "push.circuit_breaker.failure_rate",
+			restart: true,
+			value:   func(c *Config) any { return c.Push.CircuitBreaker.FailureRate },
+		},
+		{
+			name:    "号码池需要重启",
+			yaml:    validBase + "privacy:\n  x_numbers: 50\n",
+			key:     "privacy.x_numbers",
+			restart: true,
+			value:   func(c *Config) any { return c.Privacy.XNumbers },
+		},
+		{
+			name:    "号码池编号需要重启",
+			yaml:    validBase + "privacy:\n  number_pool_no: \"NP0002\"\n",
+			key:     "privacy.number_pool_no",
+			restart: true,
+			value:   func(c *Config) any { return c.Privacy.NumberPoolNo },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, next, changes, err := reloadYAML(t, validBase, tt.yaml)
+			if err != nil {
+				t.Fatalf("Reload() = %v", err)
+			}
+			if len(changes) != 1 || changes[0].Key != tt.key {
+				t.Fatalf("修改项为 %v, 期望只有 %s", changes, tt.key)
+			}
+			if changes[0].Restart != tt.restart {
+				t.Fatalf("%s 需要重启为 %v, 期望 %v", tt.key, changes[0].Restart, tt.restart)
+			}
+			// 需要重启的配置项在新配置中保持当前值
+			kept := tt.value(next) == tt.value(current)
+			if kept != tt.restart {
+				t.Fatalf("%s 重新加载后为 %v, 当前为 %v", tt.key, tt.value(next), tt.value(current))
+			}
+		})
+	}
+}
+
+// twoAccounts 两个账号的多租户配置，A 配置了密钥
+const twoAccounts = `accounts:
+  - id: "A"
+    service_type: 100
+    secret: "s1"
+  - id: "B"
+    service_type: 100
+`
+
+func TestReloadChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   []Change
+	}{
+		{
+			name:   "密钥不输出取值",
+			before: strings.Replace(validBase, "  service_type: 100\n", "  service_type: 100\n  secret: \"old\"\n", 1),
+			after:  strings.Replace(validBase, "  service_type: 100\n", "  service_type: 100\n  secret: \"new\"\n", 1),
+			want: []Change{
+				{Key: "account.secret", Old: "******", New: "******"},
+				{Key: "accounts[0].secret", Old: "******", New: "******"},
+			},
+		},
+		{
+			name:   "账号逐个比较",
+			before: validBase + twoAccounts,
+			after:  validBase + strings.Replace(twoAccounts, "s1", "s2", 1) + "    weight: 3\n",
+			want: []Change{
+				{Key: "accounts[0].secret", Old: "******", New: "******"},
+				{Key: "accounts[1].weight", Old: "1", New: "3"},
+			},
+		},
+		{
+			name:   "账号个数变化",
+			before: validBase + twoAccounts,
+			after:  validBase + twoAccounts + "  - id: \"C\"\n    service_type: 100\n",
+			want:   []Change{{Key: "accounts", Old: "2项", New: "3项"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, changes, err := reloadYAML(t, tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("Reload() = %v", err)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("修改项为 %v, 期望 %v", changes, tt.want)
+			}
+			for i := range tt.want {
+				if changes[i] != tt.want[i] {
+					t.Fatalf("修改项为 %v, 期望 %v", changes, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadInvalid(t *testing.T) {
+	// 新配置校验失败时仍返回修改项，不返回新配置
+	_, next, changes, err := reloadYAML(t, validBase, strings.Replace(validBase, "times: 3", "times: 5", 1))
+	if err == nil || !strings.Contains(err.Error(), "需要至少5个重试间隔") {
+		t.Fatalf("Reload() = %v, 期望重试间隔不足的错误", err)
+	}
+	if next != nil {
+		t.Fatal("校验失败时返回了新配置")
+	}
+	if len(changes) != 1 || changes[0].Key != "retry.times" {
+		t.Fatalf("修改项为 %v, 期望只有 retry.times", changes)
+	}
+}
@@ -0,0 +1,10 @@
+package config
+
+// SubscriptionConfig 一个状态事件订阅，接收方按订阅ID接收筛选后的事件
+type SubscriptionConfig struct {
+	ID          string `yaml:"id"`           // 推送消息中的 subscriptionId
+	Account     string `yaml:"account"`      // 只接收该账号的事件，为空时接收所有账号
+	URL         string `yaml:"url"`          // 回调地址
+	EventTypes  []int  `yaml:"event_types"`  // 接收的事件类型，为空时接收全部
+	MessageType int    `yaml:"message_type"` // 推送消息中的 messageType，未配置时为1
+}
@@ -0,0 +1,397 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cdr/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem 配置中的一个问题
+type Problem struct {
+	Key     string // 配置项路径，如 push.workers
+	Line    int    // 在配置文件中的行号，取值来自默认值、环境变量或命令行参数时为0
+	Source  string // 取值来自环境变量或命令行参数时的来源
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.Key
+	switch {
+	case p.Source != "":
+		location += "（" + p.Source + "）"
+	case p.Line > 0:
+		location += fmt.Sprintf("（第%d行）", p.Line)
+	}
+	if location == "" {
+		return p.Message
+	}
+	return location + ": " + p.Message
+}
+
+// ValidationError 配置校验失败，包含发现的全部问题
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := []string{fmt.Sprintf("配置校验失败，共%d个问题:", len(e.Problems))}
+	for _, p := range e.Problems {
+		lines = append(lines, "  "+p.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// walk 记录配置项的行号，并检查配置文件中是否有未知的配置项
+func (d *document) walk(node *yaml.Node, t reflect.Type, prefix string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			d.walk(child, t, prefix)
+		}
+	case yaml.SequenceNode:
+		// 列表元素的路径带下标，如 accounts[0].id
+		if t.Kind() == reflect.Slice {
+			key := strings.TrimSuffix(prefix, ".")
+			for i, child := range node.Content {
+				d.walk(child, t.Elem(), fmt.Sprintf("%s[%d].", key, i))
+			}
+		}
+	case yaml.MappingNode:
+		if t.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			key := prefix + keyNode.Value
+			sf, ok := yamlField(t, keyNode.Value)
+			if !ok {
+				d.problems = append(d.problems, Problem{Key: key, Line: keyNode.Line, Message: "未知的配置项"})
+				continue
+			}
+			if _, seen := d.lines[key]; !seen {
+				d.lines[key] = keyNode.Line
+			}
+			d.walk(valueNode, sf.Type, key+".")
+		}
+	}
+}
+
+// yamlField 按YAML名称查找结构体字段
+func yamlField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if tag, _, _ := strings.Cut(sf.Tag.Get("yaml"), ","); tag == name {
+			return sf, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// decodeErrorLine 匹配 yaml.TypeError 中的单条错误，如 "line 5: cannot unmarshal !!str `abc` into int"
+var decodeErrorLine = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// addDecodeError 将取值类型错误按行号对应到配置项
+func (d *document) addDecodeError(err error) {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		d.problems = append(d.problems, Problem{Message: fmt.Sprintf("解析配置文件失败: %v", err)})
+		return
+	}
+	keys := make(map[int]string, len(d.lines))
+	for key, line := range d.lines {
+		// 同一行有多个配置项时（如行内映射）取最长的路径
+		if len(key) > len(keys[line]) {
+			keys[line] = key
+		}
+	}
+	for _, msg := range typeErr.Errors {
+		m := decodeErrorLine.FindStringSubmatch(msg)
+		if m == nil {
+			d.problems = append(d.problems, Problem{Message: "取值类型错误: " + msg})
+			continue
+		}
+		line, _ := strconv.Atoi(m[1])
+		d.problems = append(d.problems, Problem{Key: keys[line], Line: line, Message: "取值类型错误: " + m[2]})
+	}
+}
+
+// parseError 返回解析时发现的问题，没有问题时返回nil
+func (d *document) parseError() error {
+	if len(d.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: d.problems}
+}
+
+// validator 收集校验发现的问题
+type validator struct {
+	doc      *document
+	problems []Problem
+}
+
+// fail 记录配置项的一个问题，解析时已发现问题的配置项不再重复报告
+func (v *validator) fail(key, format string, args ...any) {
+	for _, p := range v.doc.problems {
+		if p.Key == key {
+			return
+		}
+	}
+	v.problems = append(v.problems, Problem{
+		Key:     key,
+		Line:    v.doc.lines[key],
+		Source:  v.doc.sources[key],
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// checkURL 检查推送地址是否为完整的HTTP(S)地址
+func (v *validator) checkURL(key, value string, required bool) {
+	if value == "" {
+		if required {
+			v.fail(key, "未配置")
+		}
+		return
+	}
+	if err := CheckURL(value); err != nil {
+		v.fail(key, "%v", err)
+	}
+}
+
+// CheckURL 检查推送地址是否为完整的HTTP(S)地址，管理接口提交的地址使用相同的规则
+func CheckURL(value string) error {
+	u, err := url.Parse(value)
+	switch {
+	case err != nil:
+		return fmt.Errorf("不是有效的URL: %v", err)
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("协议必须为http或https: %q", value)
+	case u.Host == "":
+		return fmt.Errorf("缺少主机名: %q", value)
+	}
+	return nil
+}
+
+// checkPair 检查成对的文件配置是否同时配置
+func (v *validator) checkPair(certKey, cert, keyKey, key string) {
+	if (cert == "") != (key == "") {
+		if cert == "" {
+			v.fail(certKey, "必须与 %s 同时配置", keyKey)
+		} else {
+			v.fail(keyKey, "必须与 %s 同时配置", certKey)
+		}
+	}
+}
+
+// checkServiceType 检查业务类型是否受支持
+func (v *validator) checkServiceType(key string, serviceType int) {
+	if !models.ValidServiceType(serviceType) {
+		v.fail(key, "不支持的服务类型%d，可选值: %d（语音SIP服务）、%d（隐私号服务）",
+			serviceType, models.ServiceTypeSIP, models.ServiceTypePrivacy)
+	}
+}
+
+// checkRetry 检查重试次数和重试间隔，第n次尝试失败后等待 delays[n] 秒，最多尝试 times 次
+func (v *validator) checkRetry(prefix string, times int, delays []int) {
+	if times <= 0 {
+		v.fail(prefix+".times", "必须大于0，当前为%d", times)
+	}
+	if len(delays) == 0 {
+		v.fail(prefix+".delays", "未配置")
+	} else if len(delays) < times {
+		v.fail(prefix+".delays", "%s.times 为%d，需要至少%d个重试间隔，当前只有%d个", prefix, times, times, len(delays))
+	}
+	for i, delay := range delays {
+		if delay < 0 {
+			v.fail(prefix+".delays", "第%d个重试间隔不能为负数", i+1)
+		}
+	}
+}
+
+// usesGlobalURL 判断是否有账号未单独配置推送地址，需要使用全局地址
+func usesGlobalURL(accounts []AccountConfig, url func(AccountConfig) string) bool {
+	for _, account := range accounts {
+		if url(account) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAccounts 检查 accounts 中的每个账号
+//
+// 单独配置了重试计划的账号按合并全局配置后的取值检查，未配置的沿用全局 retry 的检查结果。
+func (v *validator) checkAccounts(c *Config) {
+	seen := make(map[string]string, len(c.Accounts))
+	for i, account := range c.Accounts {
+		prefix := fmt.Sprintf("accounts[%d]", i)
+		switch first, dup := seen[account.ID]; {
+		case account.ID == "":
+			v.fail(prefix+".id", "未配置")
+		case dup:
+			v.fail(prefix+".id", "账号 %q 与 %s 重复", account.ID, first)
+		default:
+			seen[account.ID] = prefix
+		}
+		v.checkServiceType(prefix+".service_type", account.ServiceType)
+		if account.Weight < 0 {
+			v.fail(prefix+".weight", "不能为负数")
+		}
+		v.checkURL(prefix+".cdr_url", account.CdrURL, false)
+		v.checkURL(prefix+".status_url", account.StatusURL, false)
+		if account.Retry.Times != 0 || account.Retry.Delays != nil {
+			times, delays := c.RetryFor(&account)
+			v.checkRetry(prefix+".retry", times, delays)
+		}
+	}
+}
+
+// checkSubscriptions 检查 subscriptions 中的每个订阅
+func (v *validator) checkSubscriptions(c *Config) {
+	seen := make(map[string]string, len(c.Subscriptions))
+	for i, sub := range c.Subscriptions {
+		prefix := fmt.Sprintf("subscriptions[%d]", i)
+		switch first, dup := seen[sub.ID]; {
+		case sub.ID == "":
+			v.fail(prefix+".id", "未配置")
+		case dup:
+			v.fail(prefix+".id", "订阅 %q 与 %s 重复", sub.ID, first)
+		default:
+			seen[sub.ID] = prefix
+		}
+		if sub.Account != "" && c.FindAccount(sub.Account) == nil {
+			v.fail(prefix+".account", "账号 %q 不存在", sub.Account)
+		}
+		v.checkURL(prefix+".url", sub.URL, true)
+		for _, eventType := range sub.EventTypes {
+			if !models.ValidEventType(eventType) {
+				v.fail(prefix+".event_types", "不支持的事件类型%d，可选值: %d（呼叫中）、%d（振铃中）、%d（已接听）、%d（已结束）",
+					eventType, models.EventTypeCalling, models.EventTypeRinging, models.EventTypeAnswered, models.EventTypeEnded)
+			}
+		}
+		if sub.MessageType < 0 {
+			v.fail(prefix+".message_type", "不能为负数")
+		}
+	}
+}
+
+// sortedKeys 返回排序后的映射键，使问题按固定顺序报告
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validate 校验配置，返回包含解析和校验发现的全部问题的 *ValidationError
+func (d *document) validate() error {
+	v := &validator{doc: d, problems: append([]Problem(nil), d.problems...)}
+	c := d.cfg
+
+	// 推送，所有账号都单独配置了推送地址时可以不配置
+	v.checkURL("push.cdr_url", c.Push.CdrURL, usesGlobalURL(c.Accounts, func(a AccountConfig) string { return a.CdrURL }))
+	v.checkURL("push.status_url", c.Push.StatusURL,
+		len(c.Subscriptions) == 0 && usesGlobalURL(c.Accounts, func(a AccountConfig) string { return a.StatusURL }))
+	if c.Push.Workers <= 0 {
+		v.fail("push.workers", "必须大于0，当前为%d", c.Push.Workers)
+	}
+	if c.Push.CdrTimeout < 0 {
+		v.fail("push.cdr_timeout", "不能为负数")
+	}
+	if c.Push.StatusTimeout < 0 {
+		v.fail("push.status_timeout", "不能为负数")
+	}
+	switch c.Push.HTTP.TLSMinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		v.fail("push.http.tls_min_version", "不支持的TLS版本 %q，可选值: 1.0、1.1、1.2、1.3", c.Push.HTTP.TLSMinVersion)
+	}
+	v.checkPair("push.http.cert_file", c.Push.HTTP.CertFile, "push.http.key_file", c.Push.HTTP.KeyFile)
+	if c.Push.Batch.Format != "json" && c.Push.Batch.Format != "ndjson" {
+		v.fail("push.batch.format", "不支持的批量推送格式 %q，可选值: json、ndjson", c.Push.Batch.Format)
+	}
+	if cb := c.Push.CircuitBreaker; cb.Enabled {
+		if cb.FailureRate < 1 || cb.FailureRate > 100 {
+			v.fail("push.circuit_breaker.failure_rate", "必须在1到100之间，当前为%d", cb.FailureRate)
+		}
+		if cb.MinRequests > cb.Window {
+			v.fail("push.circuit_breaker.min_requests", "不能大于统计窗口 window（%d）", cb.Window)
+		}
+	}
+
+	// 账号
+	if d.legacy {
+		if c.Account.ID == "" {
+			v.fail("account.id", "未配置")
+		}
+		v.checkServiceType("account.service_type", c.Account.ServiceType)
+	} else {
+		v.checkAccounts(c)
+	}
+
+	// 订阅
+	v.checkSubscriptions(c)
+
+	// 重试
+	v.checkRetry("retry", c.Retry.Times, c.Retry.Delays)
+
+	// 速率
+	if c.Rate.NewCall < 0 {
+		v.fail("rate.new_call", "不能为负数")
+	}
+	if c.Rate.CDR < 0 {
+		v.fail("rate.cdr", "不能为负数")
+	}
+	if c.Rate.Status < 0 {
+		v.fail("rate.status", "不能为负数")
+	}
+	for _, endpoint := range sortedKeys(c.Rate.Endpoints) {
+		v.checkURL("rate.endpoints", endpoint, true)
+		if rate := c.Rate.Endpoints[endpoint]; rate < 0 {
+			v.fail("rate.endpoints", "%s 的速率不能为负数", endpoint)
+		}
+	}
+
+	// 流量曲线，各曲线的参数由服务层校验
+	switch c.Load.Profile {
+	case "", "ramp", "step", "spike", "diurnal":
+	default:
+		v.fail("load.profile", "不支持的流量曲线 %q，可选值: ramp、step、spike、diurnal", c.Load.Profile)
+	}
+
+	// 管理服务
+	v.checkPair("admin.cert_file", c.Admin.CertFile, "admin.key_file", c.Admin.KeyFile)
+
+	// 通话模拟，结局名称由服务层校验
+	for _, outcome := range sortedKeys(c.Simulation.Outcomes) {
+		if weight := c.Simulation.Outcomes[outcome]; weight < 0 {
+			v.fail("simulation.outcomes", "%s 的权重不能为负数", outcome)
+		}
+	}
+
+	// 隐私号
+	if c.Privacy.AXRatio < 0 || c.Privacy.AXRatio > 100 {
+		v.fail("privacy.ax_ratio", "必须在0到100之间，当前为%d", c.Privacy.AXRatio)
+	}
+
+	if len(v.problems) == 0 {
+		return nil
+	}
+
+	// 按行号排序，没有行号的（默认值、环境变量、命令行参数）排在最后
+	sort.SliceStable(v.problems, func(i, j int) bool {
+		li, lj := v.problems[i].Line, v.problems[j].Line
+		return li != 0 && (lj == 0 || li < lj)
+	})
+	return &ValidationError{Problems: v.problems}
+}
@@ -0,0 +1,191 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validBase 一份可以通过校验的最小配置，各用例在此基础上修改
+const validBase = `push:
+  cdr_url: "http://localhost:8081/callback/v1/record"
+  status_url: "http://localhost:8081/callback/v1/status"
+  workers: 10
+account:
+  id: "TEST_ACCOUNT"
+  service_type: 100
+retry:
+  times: 3
+  delays: [0, 5, 30]
+`
+
+// wantProblem 期望报告的问题，message 只需是实际信息的一部分
+type wantProblem struct {
+	key     string
+	line    int
+	message string
+}
+
+// loadYAML 将配置写入临时文件后加载
+func loadYAML(t *testing.T, content string, flags Overrides) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Load(path, flags)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		flags Overrides
+		want  []wantProblem
+	}{
+		{
+			name: "有效配置",
+			yaml: validBase,
+		},
+		{
+			name: "未知配置项",
+			yaml: strings.Replace(validBase, "  workers: 10\n", "  workers: 10\n  worker_count: 5\n", 1),
+			want: []wantProblem{{"push.worker_count", 5, "未知的配置项"}},
+		},
+		{
+			name: "未知的顶层配置项",
+			yaml: validBase + "retries:\n  times: 3\n",
+			want: []wantProblem{{"retries", 11, "未知的配置项"}},
+		},
+		{
+			name: "取值类型错误",
+			yaml: strings.Replace(validBase, "workers: 10", "workers: many", 1),
+			want: []wantProblem{{"push.workers", 4, "取值类型错误"}},
+		},
+		{
+			name: "取值无效",
+			yaml: strings.Replace(validBase, "workers: 10", "workers: 0", 1),
+			want: []wantProblem{{"push.workers", 4, "必须大于0"}},
+		},
+		{
+			name: "重试间隔少于重试次数",
+			yaml: strings.Replace(validBase, "times: 3", "times: 5", 1),
+			want: []wantProblem{{"retry.delays", 10, "需要至少5个重试间隔，当前只有3个"}},
+		},
+		{
+			name: "重试间隔多于重试次数",
+			yaml: strings.Replace(validBase, "times: 3", "times: 1", 1),
+		},
+		{
+			name: "重试次数为0",
+			yaml: strings.Replace(validBase, "times: 3", "times: 0", 1),
+			want: []wantProblem{{"retry.times", 9, "必须大于0"}},
+		},
+		{
+			name: "账号服务类型无效",
+			yaml: strings.Replace(validBase, "service_type: 100", "service_type: 300", 1),
+			want: []wantProblem{{"account.service_type", 7, "不支持的服务类型300"}},
+		},
+		{
+			name: "多账号中的服务类型无效",
+			yaml: validBase + `accounts:
+  - id: "A"
+    service_type: 100
+  - id: "B"
+    service_type: 150
+`,
+			want: []wantProblem{{"accounts[1].service_type", 15, "不支持的服务类型150"}},
+		},
+		{
+			name: "多账号的重试计划按合并后的取值检查",
+			yaml: validBase + `accounts:
+  - id: "A"
+    service_type: 100
+    retry:
+      times: 4
+`,
+			want: []wantProblem{{"accounts[0].retry.delays", 0, "需要至少4个重试间隔，当前只有3个"}},
+		},
+		{
+			name:  "命令行参数覆盖后的取值无效",
+			yaml:  validBase,
+			flags: Overrides{"account.service_type": "999"},
+			want:  []wantProblem{{"account.service_type", 7, "不支持的服务类型999"}},
+		},
+		{
+			name:  "命令行参数覆盖配置文件中类型错误的取值",
+			yaml:  strings.Replace(validBase, "workers: 10", "workers: many", 1),
+			flags: Overrides{"push.workers": "8"},
+		},
+		{
+			name: "报告全部问题并按行号排序",
+			yaml: `push:
+  cdr_url: "ftp://localhost/cdr"
+  status_url: "http://localhost:8081/callback/v1/status"
+  workers: -1
+  unknown_option: true
+account:
+  id: ""
+  service_type: 0
+retry:
+  times: 4
+  delays: [0, -5]
+`,
+			want: []wantProblem{
+				{"push.cdr_url", 2, "协议必须为http或https"},
+				{"push.workers", 4, "必须大于0"},
+				{"push.unknown_option", 5, "未知的配置项"},
+				{"account.id", 7, "未配置"},
+				{"account.service_type", 8, "不支持的服务类型0"},
+				{"retry.delays", 11, "需要至少4个重试间隔"},
+				{"retry.delays", 11, "第2个重试间隔不能为负数"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadYAML(t, tt.yaml, tt.flags)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load() = %v, 期望校验通过", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Load() = %v, 期望 *ValidationError", err)
+			}
+			if len(verr.Problems) != len(tt.want) {
+				t.Fatalf("报告了%d个问题, 期望%d个:\n%v", len(verr.Problems), len(tt.want), verr)
+			}
+			for i, want := range tt.want {
+				got := verr.Problems[i]
+				if got.Key != want.key || got.Line != want.line || !strings.Contains(got.Message, want.message) {
+					t.Errorf("第%d个问题为 %q（第%d行）: %s, 期望 %q（第%d行）包含 %q",
+						i+1, got.Key, got.Line, got.Message, want.key, want.line, want.message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateReportsOverrideSource(t *testing.T) {
+	t.Setenv(EnvName("push.workers"), "0")
+	_, err := loadYAML(t, validBase, nil)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 1 {
+		t.Fatalf("Load() = %v, 期望1个问题", err)
+	}
+	got := verr.Problems[0]
+	if got.Key != "push.workers" || got.Source != "环境变量 CDR_PUSH_WORKERS" {
+		t.Fatalf("问题为 %+v, 期望来源为环境变量 CDR_PUSH_WORKERS", got)
+	}
+	if want := "push.workers（环境变量 CDR_PUSH_WORKERS）: 必须大于0，当前为0"; got.String() != want {
+		t.Fatalf("问题显示为 %q, 期望 %q", got.String(), want)
+	}
+}
@@ -7,13 +7,15 @@ type CallStatus struct {
 	ServiceType    int    `json:"serviceType"`
 	Caller         string `json:"caller"`
 	Callee         string `json:"callee"`
-	EventTime      string  `json:"eventTime"`
+	EventTime      string `json:"eventTime"`
 	EventType      int    `json:"eventType"`
 	AllEventType   []int  `json:"allEventType"`
 	MessageType    int    `json:"messageType"`
 	PhoneNoX       string `json:"phoneNoX,omitempty"`
 	PhoneNoA       string `json:"phoneNoA,omitempty"`
 	PhoneNoB       string `json:"phoneNoB,omitempty"`
+	NumberPoolNo   string `json:"numberPoolNo,omitempty"`   // 隐私号号码池编号，仅隐私号服务
+	SecretCallType int    `json:"secretCallType,omitempty"` // 隐私号呼叫类型，仅隐私号服务
 	Party          int    `json:"party"`
 	SubscriptionID string `json:"subscriptionId"`
 	UserData       string `json:"userData"`
@@ -26,3 +28,8 @@ const (
 	EventTypeAnswered = 3 // 已接听
 	EventTypeEnded    = 4 // 已结束
 )
+
+// ValidEventType 判断是否为支持的呼叫事件类型
+func ValidEventType(eventType int) bool {
+	return eventType >= EventTypeCalling && eventType <= EventTypeEnded
+}
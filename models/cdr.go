@@ -34,3 +34,44 @@ type CDR struct {
 	CDRType            int    `json:"cdrType"`
 	UserData           string `json:"userData"`
 }
+
+// CallResult 通话结果
+const (
+	CallResultAnswered     = 1 // 正常接通
+	CallResultPowerOff     = 2 // 关机
+	CallResultSuspended    = 3 // 停机
+	CallResultBusy         = 4 // 被叫忙
+	CallResultNoAnswer     = 5 // 无人接听
+	CallResultRejected     = 6 // 被叫拒接
+	CallResultCallerCancel = 7 // 主叫振铃中挂机
+	CallResultUnbound      = 8 // 隐私号绑定关系不存在或已过期
+)
+
+// ValidCallResult 判断是否为支持的通话结果
+func ValidCallResult(callResult int) bool {
+	return callResult >= CallResultAnswered && callResult <= CallResultUnbound
+}
+
+// ReleaseType 释放方
+const (
+	ReleaseTypeCaller  = 1 // 主叫挂机
+	ReleaseTypeCallee  = 2 // 被叫挂机
+	ReleaseTypeNetwork = 3 // 网络/平台释放
+)
+
+// ServiceType 服务类型
+const (
+	ServiceTypeSIP     = 100 // 语音SIP服务
+	ServiceTypePrivacy = 200 // 隐私号服务
+)
+
+// ValidServiceType 判断是否为支持的服务类型
+func ValidServiceType(serviceType int) bool {
+	return serviceType == ServiceTypeSIP || serviceType == ServiceTypePrivacy
+}
+
+// SecretCallType 隐私号呼叫类型
+const (
+	SecretCallTypeAToB = 10 // A经X呼叫B
+	SecretCallTypeBToA = 11 // B（或AX模式下的任意号码）经X呼叫A
+)
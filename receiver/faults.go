@@ -0,0 +1,111 @@
+package receiver
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// Faults 故障注入配置，比例为百分比，按 重置连接、超时、错误状态码 的顺序依次判定
+type Faults struct {
+	LatencyMs int `json:"latencyMs"` // 每个请求的固定延迟（毫秒）
+	JitterMs  int `json:"jitterMs"`  // 在固定延迟上随机增加0到该值的延迟（毫秒）
+
+	ResetRate   float64 `json:"resetRate"`   // 直接重置连接的请求比例
+	TimeoutRate float64 `json:"timeoutRate"` // 不响应的请求比例，直到推送方超时断开或等待 hangSec 秒后返回504
+	HangSec     int     `json:"hangSec"`     // 超时注入最长的等待时间（秒），为0时等待5分钟
+
+	ErrorRate  float64 `json:"errorRate"`  // 返回错误状态码的请求比例
+	ErrorCodes []int   `json:"errorCodes"` // 随机选择的错误状态码，为空时使用500
+	RetryAfter int     `json:"retryAfter"` // 返回429和503时附带的 Retry-After（秒），为0时不附带
+
+	Kinds []string `json:"kinds,omitempty"` // 生效的接口：cdr、status，为空时两个接口都生效
+}
+
+// fault 一次请求注入的故障
+type fault int
+
+const (
+	faultNone fault = iota
+	faultReset
+	faultTimeout
+	faultError
+)
+
+// faultNames 故障在统计中的名称
+var faultNames = map[fault]string{
+	faultReset:   "reset",
+	faultTimeout: "timeout",
+	faultError:   "error",
+}
+
+// Validate 检查故障注入配置
+func (f *Faults) Validate() error {
+	if f.LatencyMs < 0 || f.JitterMs < 0 || f.HangSec < 0 || f.RetryAfter < 0 {
+		return fmt.Errorf("latencyMs、jitterMs、hangSec、retryAfter 不能为负数")
+	}
+	for _, rate := range []float64{f.ResetRate, f.TimeoutRate, f.ErrorRate} {
+		if rate < 0 || rate > 100 {
+			return fmt.Errorf("故障比例必须在0到100之间")
+		}
+	}
+	if f.ResetRate+f.TimeoutRate+f.ErrorRate > 100 {
+		return fmt.Errorf("resetRate、timeoutRate、errorRate 之和不能超过100")
+	}
+	for _, code := range f.ErrorCodes {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("错误状态码必须在400到599之间: %d", code)
+		}
+	}
+	for _, kind := range f.Kinds {
+		if kind != KindCDR && kind != KindStatus {
+			return fmt.Errorf("不支持的接口 %q，可选值: cdr、status", kind)
+		}
+	}
+	return nil
+}
+
+// appliesTo 判断故障注入是否作用于指定接口
+func (f *Faults) appliesTo(kind string) bool {
+	return len(f.Kinds) == 0 || slices.Contains(f.Kinds, kind)
+}
+
+// delay 返回本次请求的注入延迟
+func (f *Faults) delay() time.Duration {
+	ms := f.LatencyMs
+	if f.JitterMs > 0 {
+		ms += rand.Intn(f.JitterMs + 1)
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// roll 按比例决定本次请求注入的故障
+func (f *Faults) roll() fault {
+	n := rand.Float64() * 100
+	switch {
+	case n < f.ResetRate:
+		return faultReset
+	case n < f.ResetRate+f.TimeoutRate:
+		return faultTimeout
+	case n < f.ResetRate+f.TimeoutRate+f.ErrorRate:
+		return faultError
+	}
+	return faultNone
+}
+
+// errorCode 返回本次注入的错误状态码
+func (f *Faults) errorCode() int {
+	if len(f.ErrorCodes) == 0 {
+		return 500
+	}
+	return f.ErrorCodes[rand.Intn(len(f.ErrorCodes))]
+}
+
+// hang 返回超时注入最长的等待时间
+func (f *Faults) hang() time.Duration {
+	if f.HangSec <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(f.HangSec) * time.Second
+}
@@ -0,0 +1,359 @@
+// Package receiver 模拟推送接收方，用于本地联调和测试
+//
+// 接收CDR和状态推送，按 models 中的结构校验后保存在内存中，可以注入延迟、错误状态码、
+// 超时和连接重置，并提供查询接口供测试断言实际收到的推送。CDR接口支持批量推送，
+// 批量中校验失败的记录通过 {"rejectedCallIds": [...]} 返回。
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cdr/signature"
+)
+
+// kindNames 接口在日志中的名称
+var kindNames = map[string]string{
+	KindCDR:    "CDR",
+	KindStatus: "状态",
+}
+
+// Options 接收方配置
+type Options struct {
+	CDRPath    string // CDR推送路径
+	StatusPath string // 状态推送路径
+	Secret     string // 配置后校验请求签名，签名错误返回401
+	MaxEvents  int    // 最多保存的事件数，超出后丢弃最早的事件
+	Faults     Faults // 启动时的故障注入配置，运行中可以通过接口修改
+}
+
+// EndpointStats 一个接口的请求统计
+type EndpointStats struct {
+	Requests     uint64            `json:"requests"`
+	Accepted     uint64            `json:"accepted"`     // 校验通过并保存的记录数
+	Rejected     uint64            `json:"rejected"`     // 校验失败的记录数
+	Unauthorized uint64            `json:"unauthorized"` // 签名校验失败的请求数
+	Faults       map[string]uint64 `json:"faults"`       // 按类型统计的注入故障数
+}
+
+// Server 模拟接收方
+type Server struct {
+	options  Options
+	store    *Store
+	verifier *signature.Verifier // 未配置密钥时为nil
+	faults   atomic.Pointer[Faults]
+	stats    map[string]*EndpointStats
+	mutex    sync.Mutex // 保护 stats
+}
+
+// New 创建模拟接收方
+func New(options Options) (*Server, error) {
+	if err := options.Faults.Validate(); err != nil {
+		return nil, fmt.Errorf("故障注入配置错误: %v", err)
+	}
+	s := &Server{
+		options: options,
+		store:   NewStore(options.MaxEvents),
+		stats: map[string]*EndpointStats{
+			KindCDR:    {Faults: make(map[string]uint64)},
+			KindStatus: {Faults: make(map[string]uint64)},
+		},
+	}
+	if options.Secret != "" {
+		s.verifier = signature.NewVerifier(options.Secret, 5*time.Minute)
+	}
+	faults := options.Faults
+	s.faults.Store(&faults)
+	return s, nil
+}
+
+// Handler 返回接收推送和查询接口的HTTP处理器
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+s.options.CDRPath, s.handlePush(KindCDR))
+	mux.HandleFunc("POST "+s.options.StatusPath, s.handlePush(KindStatus))
+	mux.HandleFunc("GET /receiver/events", s.handleEvents)
+	mux.HandleFunc("DELETE /receiver/events", s.handleClear)
+	mux.HandleFunc("GET /receiver/stats", s.handleStats)
+	mux.HandleFunc("GET /receiver/faults", s.handleGetFaults)
+	mux.HandleFunc("PUT /receiver/faults", s.handlePutFaults)
+	return mux
+}
+
+// pushResponse 推送接口的响应体，code 为0表示接收成功
+type pushResponse struct {
+	Code            int      `json:"code"`
+	Message         string   `json:"message"`
+	RejectedCallIDs []string `json:"rejectedCallIds,omitempty"`
+}
+
+// handlePush 处理一个推送接口的请求
+func (s *Server) handlePush(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.count(kind, func(st *EndpointStats) { st.Requests++ })
+		body, err := io.ReadAll(io.LimitReader(r.Body, 10<<20))
+		if err != nil {
+			return
+		}
+		if !s.injectFault(kind, w, r) {
+			return
+		}
+
+		if s.verifier != nil {
+			if err := s.verifier.Verify(r.Header, body); err != nil {
+				s.count(kind, func(st *EndpointStats) { st.Unauthorized++ })
+				log.Printf("%s推送签名校验失败: %v", kindNames[kind], err)
+				writeJSON(w, http.StatusUnauthorized, pushResponse{Code: http.StatusUnauthorized, Message: err.Error()})
+				return
+			}
+		}
+
+		records, batch, err := splitRecords(body, r.Header.Get("Content-Type"))
+		if err != nil {
+			s.count(kind, func(st *EndpointStats) { st.Rejected++ })
+			log.Printf("%s推送请求体格式错误: %v", kindNames[kind], err)
+			writeJSON(w, http.StatusBadRequest, pushResponse{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+
+		var rejected []string
+		var problems []string
+		for _, record := range records {
+			event := s.receive(kind, record)
+			if !event.Valid {
+				rejected = append(rejected, event.CallID)
+				problems = event.Problems
+				log.Printf("%s推送校验失败 Account:%s, CallID:%s: %s", kindNames[kind], event.AccountID, event.CallID, strings.Join(event.Problems, "; "))
+			}
+		}
+
+		// 单条推送校验失败返回400，批量推送中失败的记录通过 rejectedCallIds 返回
+		if !batch && len(rejected) > 0 {
+			writeJSON(w, http.StatusBadRequest, pushResponse{Code: http.StatusBadRequest, Message: strings.Join(problems, "; ")})
+			return
+		}
+		writeJSON(w, http.StatusOK, pushResponse{Message: "success", RejectedCallIDs: rejected})
+	}
+}
+
+// splitRecords 拆分请求体中的记录，支持单条JSON、JSON数组和每行一条的NDJSON
+func splitRecords(body []byte, contentType string) (records []json.RawMessage, batch bool, err error) {
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case strings.HasPrefix(contentType, "application/x-ndjson"):
+		scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+		scanner.Buffer(nil, len(trimmed)+1)
+		for scanner.Scan() {
+			if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+				records = append(records, json.RawMessage(append([]byte(nil), line...)))
+			}
+		}
+		return records, true, scanner.Err()
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, true, fmt.Errorf("批量推送不是有效的JSON数组: %v", err)
+		}
+		return records, true, nil
+	}
+	return []json.RawMessage{trimmed}, false, nil
+}
+
+// receive 校验并保存一条记录
+func (s *Server) receive(kind string, record json.RawMessage) *Event {
+	event := &Event{Kind: kind, ReceivedAt: time.Now(), Payload: record}
+	if kind == KindCDR {
+		cdr, problems := validateCDR(record)
+		if cdr != nil {
+			event.AccountID, event.CallID, event.SubscriptionID = cdr.AccountID, cdr.CallID, cdr.SubscriptionID
+		}
+		event.Problems = problems
+	} else {
+		status, problems := validateStatus(record)
+		if status != nil {
+			event.AccountID, event.CallID, event.SubscriptionID = status.AccountID, status.CallID, status.SubscriptionID
+			event.EventType = status.EventType
+		}
+		event.Problems = problems
+	}
+	event.Valid = len(event.Problems) == 0
+	if !json.Valid(record) {
+		// 无法解析的记录按字符串保存，保证查询结果仍是合法的JSON
+		event.Payload, _ = json.Marshal(string(record))
+	}
+
+	s.store.Add(event)
+	s.count(kind, func(st *EndpointStats) {
+		if event.Valid {
+			st.Accepted++
+		} else {
+			st.Rejected++
+		}
+	})
+	return event
+}
+
+// injectFault 按当前配置注入延迟和故障，返回false表示已注入故障，不再处理请求
+func (s *Server) injectFault(kind string, w http.ResponseWriter, r *http.Request) bool {
+	faults := s.faults.Load()
+	if !faults.appliesTo(kind) {
+		return true
+	}
+	if delay := faults.delay(); delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+
+	injected := faults.roll()
+	if injected == faultNone {
+		return true
+	}
+	s.count(kind, func(st *EndpointStats) { st.Faults[faultNames[injected]]++ })
+	switch injected {
+	case faultReset:
+		resetConnection(w)
+	case faultTimeout:
+		select {
+		case <-time.After(faults.hang()):
+			writeJSON(w, http.StatusGatewayTimeout, pushResponse{Code: http.StatusGatewayTimeout, Message: "注入的超时"})
+		case <-r.Context().Done():
+		}
+	case faultError:
+		code := faults.errorCode()
+		if faults.RetryAfter > 0 && (code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable) {
+			w.Header().Set("Retry-After", strconv.Itoa(faults.RetryAfter))
+		}
+		writeJSON(w, code, pushResponse{Code: code, Message: "注入的错误"})
+	}
+	return false
+}
+
+// resetConnection 不返回响应，直接以RST关闭连接
+func resetConnection(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	raw := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		raw = tlsConn.NetConn()
+	}
+	if tcpConn, ok := raw.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	raw.Close()
+}
+
+// count 更新一个接口的统计
+func (s *Server) count(kind string, update func(st *EndpointStats)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	update(s.stats[kind])
+}
+
+// handleEvents 查询收到的事件，参数：kind、accountId、callId、subscriptionId、eventType、valid、after、limit
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := Query{
+		Kind:           params.Get("kind"),
+		AccountID:      params.Get("accountId"),
+		CallID:         params.Get("callId"),
+		SubscriptionID: params.Get("subscriptionId"),
+	}
+	var err error
+	if q.EventType, err = intParam(params.Get("eventType")); err != nil {
+		writeError(w, fmt.Errorf("eventType 格式错误: %v", err))
+		return
+	}
+	after, err := intParam(params.Get("after"))
+	if err != nil {
+		writeError(w, fmt.Errorf("after 格式错误: %v", err))
+		return
+	}
+	q.After = int64(after)
+	if q.Limit, err = intParam(params.Get("limit")); err != nil {
+		writeError(w, fmt.Errorf("limit 格式错误: %v", err))
+		return
+	}
+	if value := params.Get("valid"); value != "" {
+		valid, err := strconv.ParseBool(value)
+		if err != nil {
+			writeError(w, fmt.Errorf("valid 格式错误: %v", err))
+			return
+		}
+		q.Valid = &valid
+	}
+
+	events := s.store.Find(q)
+	writeJSON(w, http.StatusOK, map[string]any{"count": len(events), "events": events})
+}
+
+func (s *Server) handleClear(w http.ResponseWriter, r *http.Request) {
+	deleted := s.store.Clear()
+	log.Printf("已清空%d条事件", deleted)
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	writeJSON(w, http.StatusOK, s.stats)
+}
+
+func (s *Server) handleGetFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.faults.Load())
+}
+
+// handlePutFaults 替换故障注入配置，请求体如 {"errorRate": 20, "errorCodes": [500, 503], "kinds": ["cdr"]}
+func (s *Server) handlePutFaults(w http.ResponseWriter, r *http.Request) {
+	var faults Faults
+	if err := json.NewDecoder(r.Body).Decode(&faults); err != nil {
+		writeError(w, fmt.Errorf("请求体格式错误: %v", err))
+		return
+	}
+	if err := faults.Validate(); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.faults.Store(&faults)
+	log.Printf("故障注入配置已修改: %+v", faults)
+	writeJSON(w, http.StatusOK, &faults)
+}
+
+// intParam 解析可选的整数查询参数，未提供时为0
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// writeJSON 写入JSON响应
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入 {"error": ...} 格式的400响应
+func writeError(w http.ResponseWriter, err error) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+}
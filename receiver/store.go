@@ -0,0 +1,117 @@
+package receiver
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// 接收的事件类型
+const (
+	KindCDR    = "cdr"
+	KindStatus = "status"
+)
+
+// Event 收到的一条推送记录，批量推送中的每条记录单独保存
+type Event struct {
+	Seq            int64           `json:"seq"` // 接收顺序，从1开始递增
+	Kind           string          `json:"kind"`
+	ReceivedAt     time.Time       `json:"receivedAt"`
+	AccountID      string          `json:"accountId"`
+	CallID         string          `json:"callId"`
+	EventType      int             `json:"eventType,omitempty"` // 仅状态事件
+	SubscriptionID string          `json:"subscriptionId,omitempty"`
+	Valid          bool            `json:"valid"`
+	Problems       []string        `json:"problems,omitempty"` // 校验发现的问题
+	Payload        json.RawMessage `json:"payload"`
+}
+
+// Query 事件查询条件，零值字段不参与过滤
+type Query struct {
+	Kind           string
+	AccountID      string
+	CallID         string
+	SubscriptionID string
+	EventType      int
+	Valid          *bool
+	After          int64 // 只返回 Seq 大于该值的事件
+	Limit          int   // 最多返回的条数，为0时不限制
+}
+
+// match 判断事件是否满足查询条件
+func (q Query) match(e *Event) bool {
+	switch {
+	case q.Kind != "" && e.Kind != q.Kind:
+		return false
+	case q.AccountID != "" && e.AccountID != q.AccountID:
+		return false
+	case q.CallID != "" && e.CallID != q.CallID:
+		return false
+	case q.SubscriptionID != "" && e.SubscriptionID != q.SubscriptionID:
+		return false
+	case q.EventType != 0 && e.EventType != q.EventType:
+		return false
+	case q.Valid != nil && e.Valid != *q.Valid:
+		return false
+	}
+	return e.Seq > q.After
+}
+
+// Store 在内存中按接收顺序保存事件，超过容量时丢弃最早的事件
+type Store struct {
+	capacity int
+	events   []*Event
+	seq      int64
+	mutex    sync.RWMutex
+}
+
+// NewStore 创建事件存储，capacity 为最多保存的事件数
+func NewStore(capacity int) *Store {
+	return &Store{capacity: capacity}
+}
+
+// Add 保存一条事件并分配接收顺序
+func (s *Store) Add(e *Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.seq++
+	e.Seq = s.seq
+	s.events = append(s.events, e)
+	if len(s.events) >= 2*s.capacity {
+		// 累积到两倍容量时一次性前移，避免每次添加都移动整个列表
+		n := copy(s.events, s.events[len(s.events)-s.capacity:])
+		clear(s.events[n:])
+		s.events = s.events[:n]
+	}
+}
+
+// retained 返回容量以内的事件，调用方需持有锁
+func (s *Store) retained() []*Event {
+	return s.events[max(0, len(s.events)-s.capacity):]
+}
+
+// Find 按接收顺序返回满足条件的事件
+func (s *Store) Find(q Query) []*Event {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	found := []*Event{}
+	for _, e := range s.retained() {
+		if !q.match(e) {
+			continue
+		}
+		found = append(found, e)
+		if q.Limit > 0 && len(found) >= q.Limit {
+			break
+		}
+	}
+	return found
+}
+
+// Clear 删除全部事件并返回删除的条数，接收顺序继续递增
+func (s *Store) Clear() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	n := len(s.retained())
+	s.events = nil
+	return n
+}
@@ -0,0 +1,100 @@
+package receiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"cdr/models"
+)
+
+// decodeStrict 按模型解析一条记录，出现模型中没有的字段时报错
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("记录之后有多余的内容")
+	}
+	return nil
+}
+
+// problems 收集一条记录的校验问题
+type problems []string
+
+func (p *problems) add(format string, args ...any) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// common 检查CDR和状态事件共有的字段
+func (p *problems) common(accountID, callID string, serviceType int, phoneNoX string) {
+	if accountID == "" {
+		p.add("accountId 为空")
+	}
+	if callID == "" {
+		p.add("callId 为空")
+	}
+	if !models.ValidServiceType(serviceType) {
+		p.add("不支持的 serviceType: %d", serviceType)
+	} else if serviceType == models.ServiceTypePrivacy && phoneNoX == "" {
+		p.add("隐私号业务缺少 phoneNoX")
+	}
+}
+
+// validateCDR 按 models.CDR 校验一条话单，返回解析后的话单和发现的问题
+func validateCDR(data []byte) (*models.CDR, []string) {
+	var cdr models.CDR
+	if err := decodeStrict(data, &cdr); err != nil {
+		return nil, []string{fmt.Sprintf("不符合话单格式: %v", err)}
+	}
+
+	var p problems
+	p.common(cdr.AccountID, cdr.CallID, cdr.ServiceType, cdr.PhoneNoX)
+	if !models.ValidCallResult(cdr.CallResult) {
+		p.add("不支持的 callResult: %d", cdr.CallResult)
+	}
+	if cdr.BeginCallTime <= 0 {
+		p.add("beginCallTime 未设置")
+	}
+	if cdr.StartTime != 0 && cdr.StartTime < cdr.BeginCallTime {
+		p.add("startTime 早于 beginCallTime")
+	}
+	if cdr.EndTime < cdr.BeginCallTime {
+		p.add("endTime 早于 beginCallTime")
+	}
+	if cdr.CallDuration < 0 {
+		p.add("callDuration 不能为负数")
+	}
+	if cdr.CDRCreateTime <= 0 {
+		p.add("cdrCreateTime 未设置")
+	}
+	return &cdr, p
+}
+
+// validateStatus 按 models.CallStatus 校验一条状态事件，返回解析后的事件和发现的问题
+func validateStatus(data []byte) (*models.CallStatus, []string) {
+	var status models.CallStatus
+	if err := decodeStrict(data, &status); err != nil {
+		return nil, []string{fmt.Sprintf("不符合状态事件格式: %v", err)}
+	}
+
+	var p problems
+	p.common(status.AccountID, status.CallID, status.ServiceType, status.PhoneNoX)
+	if !models.ValidEventType(status.EventType) {
+		p.add("不支持的 eventType: %d", status.EventType)
+	}
+	if seconds, err := strconv.ParseInt(status.EventTime, 10, 64); err != nil || seconds <= 0 {
+		p.add("eventTime 不是秒级时间戳: %q", status.EventTime)
+	}
+	if !slices.Contains(status.AllEventType, status.EventType) {
+		p.add("allEventType %v 不包含当前的 eventType %d", status.AllEventType, status.EventType)
+	}
+	if status.SubscriptionID == "" {
+		p.add("subscriptionId 为空")
+	}
+	return &status, p
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"math/rand"
+
+	"cdr/config"
+)
+
+// pickAccount 按权重为新建的呼叫或CDR选择账号
+//
+// 每次按当前配置计算，重新加载后的账号和权重立即生效。
+func pickAccount(cfg *config.Config) *config.AccountConfig {
+	total := 0
+	for _, account := range cfg.Accounts {
+		total += account.Weight
+	}
+	n := rand.Intn(total)
+	for i := range cfg.Accounts {
+		if n -= cfg.Accounts[i].Weight; n < 0 {
+			return &cfg.Accounts[i]
+		}
+	}
+	return &cfg.Accounts[len(cfg.Accounts)-1]
+}
@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"cdr/config"
+	"cdr/models"
+)
+
+// AdminAPI 运行时控制接口，修改只影响之后新建的呼叫和CDR，进行中的呼叫按原计划结束
+//
+// 状态推送进程同时控制新建呼叫和话单，CDR推送进程只控制CDR生成，callStatusSvc 为nil。
+// 修改运行参数的请求须携带 admin.token，未配置令牌时只能查看。
+type AdminAPI struct {
+	token         string
+	callStatusSvc *CallStatusService
+	cdrSvc        *CDRService
+	pusher        *Pusher
+	stopped       bool           // 退出流程开始后拒绝修改运行参数
+	bursts        sync.WaitGroup // 后台执行中的突发请求
+	mutex         sync.Mutex
+}
+
+// AdminState 当前的运行参数
+type AdminState struct {
+	Paused      bool           `json:"paused"`             // 是否暂停新建呼叫（CDR推送进程为CDR生成）
+	TargetRate  float64        `json:"targetRate"`         // 新建呼叫或生成CDR的目标速率（每秒），0表示不限速
+	CDRRate     float64        `json:"cdrRate"`            // CDR推送速率上限，0表示不限速
+	StatusRate  float64        `json:"statusRate"`         // 状态推送速率上限，0表示不限速
+	ServiceType int            `json:"serviceType"`        // 管理接口设置的业务类型，为0时各账号使用自己的配置
+	Outcomes    map[string]int `json:"outcomes,omitempty"` // 通话结局权重
+	ActiveCalls int            `json:"activeCalls"`        // 进行中的通话数
+}
+
+// rateRequest 修改速率的请求，未提供的字段保持不变
+type rateRequest struct {
+	Target *float64 `json:"target"` // 新建呼叫或生成CDR的速率，会替换流量曲线
+	CDR    *float64 `json:"cdr"`    // CDR推送速率上限
+	Status *float64 `json:"status"` // 状态推送速率上限
+}
+
+// NewAdminAPI 创建运行时控制接口
+func NewAdminAPI(cfg *config.Config, callStatusSvc *CallStatusService, cdrSvc *CDRService, pusher *Pusher) *AdminAPI {
+	if cfg.Admin.Token == "" {
+		log.Println("未配置 admin.token，管理接口只读")
+	}
+	return &AdminAPI{
+		token:         cfg.Admin.Token,
+		callStatusSvc: callStatusSvc,
+		cdrSvc:        cdrSvc,
+		pusher:        pusher,
+	}
+}
+
+// RegisterHandlers 在管理服务上注册运行时控制接口
+func (a *AdminAPI) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/state", a.handleState)
+	mux.HandleFunc("POST /admin/pause", a.guard(a.handlePause))
+	mux.HandleFunc("POST /admin/resume", a.guard(a.handleResume))
+	mux.HandleFunc("POST /admin/rate", a.guard(a.handleRate))
+	mux.HandleFunc("POST /admin/service-type", a.guard(a.handleServiceType))
+	mux.HandleFunc("POST /admin/outcomes", a.guard(a.handleOutcomes))
+	mux.HandleFunc("POST /admin/burst", a.guard(a.handleBurst))
+	mux.HandleFunc("GET /admin/subscriptions", a.handleListSubscriptions)
+	mux.HandleFunc("PUT /admin/subscriptions/{id}", a.guard(a.handlePutSubscription))
+	mux.HandleFunc("DELETE /admin/subscriptions/{id}", a.guard(a.handleDeleteSubscription))
+}
+
+// Stop 开始退出流程：之后修改运行参数的请求返回503，并等待后台执行中的突发请求结束
+//
+// 需在停止新建呼叫之后、等待通话结束和关闭推送器之前调用。
+func (a *AdminAPI) Stop() {
+	a.mutex.Lock()
+	a.stopped = true
+	a.mutex.Unlock()
+	a.bursts.Wait()
+}
+
+// guard 拒绝未携带正确令牌的请求，退出流程开始后拒绝所有请求
+func (a *AdminAPI) guard(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.token == "" {
+			writeError(w, http.StatusForbidden, fmt.Errorf("未配置 admin.token，管理接口只读"))
+			return
+		}
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("令牌错误"))
+			return
+		}
+		if a.isStopped() {
+			writeError(w, http.StatusServiceUnavailable, fmt.Errorf("服务正在退出"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// authorized 判断请求是否携带 Authorization: Bearer <admin.token>，按固定时间比较
+func (a *AdminAPI) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1
+}
+
+func (a *AdminAPI) isStopped() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.stopped
+}
+
+// load 返回控制新建呼叫或CDR生成的流量控制器
+func (a *AdminAPI) load() *LoadShaper {
+	if a.callStatusSvc != nil {
+		return a.callStatusSvc.Load()
+	}
+	return a.cdrSvc.Load()
+}
+
+// State 返回当前的运行参数
+func (a *AdminAPI) State() *AdminState {
+	load := a.load()
+	state := &AdminState{
+		Paused:      load.Paused(),
+		TargetRate:  load.TargetRate(),
+		CDRRate:     a.pusher.RateLimit(DeliveryKindCDR),
+		StatusRate:  a.pusher.RateLimit(DeliveryKindStatus),
+		ServiceType: a.cdrSvc.ServiceType(),
+	}
+	if a.callStatusSvc != nil {
+		state.Outcomes = a.callStatusSvc.Outcomes()
+		state.ActiveCalls = a.callStatusSvc.ActiveCalls()
+	}
+	return state
+}
+
+func (a *AdminAPI) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+func (a *AdminAPI) handlePause(w http.ResponseWriter, r *http.Request) {
+	a.load().SetPaused(true)
+	log.Println("管理接口: 暂停新建")
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+func (a *AdminAPI) handleResume(w http.ResponseWriter, r *http.Request) {
+	a.load().SetPaused(false)
+	log.Println("管理接口: 恢复新建")
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+// handleRate 修改速率，请求体如 {"target": 20, "cdr": 50, "status": 100}
+func (a *AdminAPI) handleRate(w http.ResponseWriter, r *http.Request) {
+	var req rateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	for _, rate := range []*float64{req.Target, req.CDR, req.Status} {
+		if rate != nil && *rate < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("速率不能为负数"))
+			return
+		}
+	}
+
+	if req.Target != nil {
+		a.load().SetRate(*req.Target)
+		log.Printf("管理接口: 目标速率修改为 %v/s", *req.Target)
+	}
+	if req.CDR != nil {
+		a.pusher.SetRateLimit(DeliveryKindCDR, *req.CDR)
+		log.Printf("管理接口: CDR推送速率上限修改为 %v/s", *req.CDR)
+	}
+	if req.Status != nil {
+		a.pusher.SetRateLimit(DeliveryKindStatus, *req.Status)
+		log.Printf("管理接口: 状态推送速率上限修改为 %v/s", *req.Status)
+	}
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+// handleServiceType 将所有账号切换为指定的业务类型，请求体如 {"serviceType": 200}，为0时恢复各账号的配置
+func (a *AdminAPI) handleServiceType(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ServiceType int `json:"serviceType"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ServiceType != 0 && !models.ValidServiceType(req.ServiceType) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("不支持的serviceType: %d", req.ServiceType))
+		return
+	}
+
+	a.cdrSvc.SetServiceType(req.ServiceType)
+	if req.ServiceType == 0 {
+		log.Println("管理接口: 业务类型恢复为各账号的配置")
+	} else {
+		log.Printf("管理接口: 所有账号的业务类型切换为 %d", req.ServiceType)
+	}
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+// handleOutcomes 替换通话结局权重，请求体如 {"answered": 70, "busy": 10}
+func (a *AdminAPI) handleOutcomes(w http.ResponseWriter, r *http.Request) {
+	if a.callStatusSvc == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("CDR推送进程不模拟通话结局"))
+		return
+	}
+	var outcomes map[string]int
+	if !readJSON(w, r, &outcomes) {
+		return
+	}
+	if err := a.callStatusSvc.SetOutcomes(outcomes); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("管理接口: 通话结局权重修改为 %v", outcomes)
+	writeJSON(w, http.StatusOK, a.State())
+}
+
+// handleBurst 不受速率限制立即发起一批呼叫（CDR推送进程为CDR），请求体如 {"count": 100}
+func (a *AdminAPI) handleBurst(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Count int `json:"count"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Count <= 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("count必须大于0"))
+		return
+	}
+
+	// 推送队列已满时提交会阻塞，在后台执行，推送不随请求结束而取消
+	// 登记在检查退出状态的同一把锁内完成，Stop 返回后不会再有突发请求开始
+	a.mutex.Lock()
+	if a.stopped {
+		a.mutex.Unlock()
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("服务正在退出"))
+		return
+	}
+	a.bursts.Add(1)
+	a.mutex.Unlock()
+
+	ctx := context.WithoutCancel(r.Context())
+	go func() {
+		defer a.bursts.Done()
+		if a.callStatusSvc == nil {
+			submitted, _ := a.cdrSvc.Burst(ctx, req.Count)
+			log.Printf("管理接口: 突发生成 %d 条CDR", submitted)
+			return
+		}
+		started, err := a.callStatusSvc.Burst(ctx, req.Count)
+		if err != nil {
+			log.Printf("管理接口: 突发呼叫失败: %v", err)
+		}
+		log.Printf("管理接口: 突发发起 %d/%d 个呼叫", started, req.Count)
+	}()
+	writeJSON(w, http.StatusAccepted, map[string]int{"count": req.Count})
+}
+
+// subscriptions 返回状态事件订阅表，CDR推送进程没有订阅表时写入404响应并返回nil
+func (a *AdminAPI) subscriptions(w http.ResponseWriter) *SubscriptionRegistry {
+	if a.callStatusSvc == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("CDR推送进程不推送状态事件"))
+		return nil
+	}
+	return a.callStatusSvc.Subscriptions()
+}
+
+func (a *AdminAPI) handleListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	if subs := a.subscriptions(w); subs != nil {
+		writeJSON(w, http.StatusOK, subs.List())
+	}
+}
+
+// handlePutSubscription 添加或替换订阅，请求体如 {"url": "http://...", "eventTypes": [3, 4], "messageType": 1}
+//
+// 通过管理接口的修改在配置文件中的订阅修改并重新加载后被覆盖。
+func (a *AdminAPI) handlePutSubscription(w http.ResponseWriter, r *http.Request) {
+	subs := a.subscriptions(w)
+	if subs == nil {
+		return
+	}
+	var sub Subscription
+	if !readJSON(w, r, &sub) {
+		return
+	}
+	sub.ID = r.PathValue("id")
+	if sub.Account != "" && a.callStatusSvc.config.Load().FindAccount(sub.Account) == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("账号不存在: %s", sub.Account))
+		return
+	}
+	if err := subs.Put(sub); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	log.Printf("管理接口: 订阅 %s 已更新，回调地址 %s，事件类型 %v", sub.ID, sub.URL, sub.EventTypes)
+	writeJSON(w, http.StatusOK, subs.List())
+}
+
+func (a *AdminAPI) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	subs := a.subscriptions(w)
+	if subs == nil {
+		return
+	}
+	id := r.PathValue("id")
+	if !subs.Remove(id) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("订阅不存在: %s", id))
+		return
+	}
+	log.Printf("管理接口: 订阅 %s 已删除", id)
+	writeJSON(w, http.StatusOK, subs.List())
+}
+
+// readJSON 解析JSON请求体，失败时写入400响应并返回false
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体格式错误: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeJSON 写入JSON响应
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError 写入 {"error": ...} 格式的错误响应
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
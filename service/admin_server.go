@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"cdr/config"
+)
+
+// AdminServer 管理服务，提供健康检查、指标和运行时控制接口
+//
+// 每个实例使用独立的 http.ServeMux，多个服务可以在同一进程中分别监听。
+type AdminServer struct {
+	server   *http.Server
+	mux      *http.ServeMux
+	certFile string
+	keyFile  string
+}
+
+// NewAdminServer 创建管理服务，addr 为监听地址，配置了证书时使用HTTPS
+func NewAdminServer(cfg *config.Config, addr string) *AdminServer {
+	mux := http.NewServeMux()
+	return &AdminServer{
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+			TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+		},
+		mux:      mux,
+		certFile: cfg.Admin.CertFile,
+		keyFile:  cfg.Admin.KeyFile,
+	}
+}
+
+// Mux 返回管理服务的路由，用于注册接口
+func (s *AdminServer) Mux() *http.ServeMux {
+	return s.mux
+}
+
+// Start 在后台开始监听，监听失败时记录日志
+func (s *AdminServer) Start() {
+	go func() {
+		if err := s.ListenAndServe(); err != nil {
+			log.Printf("管理服务异常退出: %v", err)
+		}
+	}()
+}
+
+// ListenAndServe 开始监听并阻塞，正常关闭时返回nil
+func (s *AdminServer) ListenAndServe() error {
+	scheme := "http"
+	if s.certFile != "" {
+		scheme = "https"
+	}
+	log.Printf("管理服务监听 %s://%s", scheme, s.server.Addr)
+
+	var err error
+	if s.certFile != "" {
+		err = s.server.ListenAndServeTLS(s.certFile, s.keyFile)
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("管理服务监听 %s 失败: %v", s.server.Addr, err)
+	}
+	return nil
+}
+
+// Shutdown 停止接受新请求，等待进行中的请求完成
+func (s *AdminServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
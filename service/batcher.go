@@ -0,0 +1,188 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"cdr/config"
+)
+
+// 批量推送的请求体格式
+const (
+	BatchFormatJSON   = "json"   // JSON数组
+	BatchFormatNDJSON = "ndjson" // 每行一条JSON记录
+)
+
+// batchResponse 接收方部分失败时返回的响应体
+type batchResponse struct {
+	RejectedCallIDs []string `json:"rejectedCallIds"`
+}
+
+// batchKey 按账号和推送地址分批，同一批记录使用同一个签名密钥
+type batchKey struct {
+	account string
+	url     string
+}
+
+// pendingBatch 同一账号、同一推送地址正在积累的一批记录
+type pendingBatch struct {
+	items []*pendingDelivery
+	bytes int // 编码后请求体的字节数
+	timer *time.Timer
+}
+
+// Batcher 按账号和推送地址积累记录，达到条数、字节数或等待时间上限后整批发送
+type Batcher struct {
+	maxCount int
+	maxBytes int
+	overhead int // 请求体中与记录数无关的字节数，JSON数组为1（方括号比逗号多1个）
+	linger   time.Duration
+	flush    func(items []*pendingDelivery)
+	batches  map[batchKey]*pendingBatch
+	closed   bool // 关闭后加入的记录立即单独发送
+	mutex    sync.Mutex
+}
+
+// NewBatcher 创建批量发送器，flush 负责发送一批记录
+func NewBatcher(cfg *config.Config, flush func(items []*pendingDelivery)) *Batcher {
+	b := &Batcher{
+		maxCount: cfg.Push.Batch.MaxCount,
+		maxBytes: cfg.Push.Batch.MaxBytes,
+		linger:   time.Duration(cfg.Push.Batch.LingerMs) * time.Millisecond,
+		flush:    flush,
+		batches:  make(map[batchKey]*pendingBatch),
+	}
+	if cfg.Push.Batch.Format != BatchFormatNDJSON {
+		b.overhead = 1
+	}
+	return b
+}
+
+// Add 加入一条记录，批次已满时立即发送
+//
+// 加入后请求体会超过字节数上限时，先发送已积累的记录再开始新的批次；
+// 单条记录本身超过上限时单独发送。
+func (b *Batcher) Add(item *pendingDelivery) {
+	key := batchKey{item.delivery.Account, item.delivery.URL}
+	size := len(item.delivery.Payload) + 1 // 记录之间的逗号或换行
+
+	var full [][]*pendingDelivery
+	b.mutex.Lock()
+	if b.closed {
+		b.mutex.Unlock()
+		b.flush([]*pendingDelivery{item})
+		return
+	}
+	batch := b.batches[key]
+	if batch != nil && batch.bytes+size > b.maxBytes {
+		full = append(full, b.take(key))
+		batch = nil
+	}
+	if batch == nil {
+		batch = &pendingBatch{bytes: b.overhead}
+		b.batches[key] = batch
+		current := batch
+		batch.timer = time.AfterFunc(b.linger, func() { b.flushBatch(key, current) })
+	}
+	batch.items = append(batch.items, item)
+	batch.bytes += size
+
+	if len(batch.items) >= b.maxCount || batch.bytes >= b.maxBytes {
+		full = append(full, b.take(key))
+	}
+	b.mutex.Unlock()
+
+	for _, items := range full {
+		b.flush(items)
+	}
+}
+
+// take 取出指定的批次，调用方需持有锁
+func (b *Batcher) take(key batchKey) []*pendingDelivery {
+	batch, ok := b.batches[key]
+	if !ok {
+		return nil
+	}
+	batch.timer.Stop()
+	delete(b.batches, key)
+	return batch.items
+}
+
+// flushBatch 等待时间到达后发送指定的批次
+//
+// 批次可能已因满额提前发送，同一推送地址已开始积累新的批次，此时不处理，
+// 避免新批次的等待时间被提前结束。
+func (b *Batcher) flushBatch(key batchKey, batch *pendingBatch) {
+	b.mutex.Lock()
+	var items []*pendingDelivery
+	if b.batches[key] == batch {
+		items = b.take(key)
+	}
+	b.mutex.Unlock()
+
+	if len(items) > 0 {
+		b.flush(items)
+	}
+}
+
+// Flush 立即发送所有正在积累的批次
+func (b *Batcher) Flush() {
+	b.flushAll(false)
+}
+
+// Close 发送所有正在积累的批次，之后加入的记录不再等待凑批
+func (b *Batcher) Close() {
+	b.flushAll(true)
+}
+
+// flushAll 发送所有正在积累的批次，closed 为true时同时关闭批量发送器
+func (b *Batcher) flushAll(closed bool) {
+	b.mutex.Lock()
+	b.closed = b.closed || closed
+	var all [][]*pendingDelivery
+	for key := range b.batches {
+		all = append(all, b.take(key))
+	}
+	b.mutex.Unlock()
+
+	for _, items := range all {
+		b.flush(items)
+	}
+}
+
+// encodeBatch 按配置的格式编码一批记录，返回请求体和Content-Type
+func encodeBatch(items []*pendingDelivery, format string) ([]byte, string) {
+	var buf bytes.Buffer
+	if format == BatchFormatNDJSON {
+		for _, item := range items {
+			buf.Write(item.delivery.Payload)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), "application/x-ndjson"
+	}
+
+	buf.WriteByte('[')
+	for i, item := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(item.delivery.Payload)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), "application/json"
+}
+
+// parseRejected 解析响应体中被拒绝的callId，响应体不是约定格式时视为全部接收
+func parseRejected(body []byte) map[string]bool {
+	var resp batchResponse
+	if len(body) == 0 || json.Unmarshal(body, &resp) != nil {
+		return nil
+	}
+	rejected := make(map[string]bool, len(resp.RejectedCallIDs))
+	for _, callID := range resp.RejectedCallIDs {
+		rejected[callID] = true
+	}
+	return rejected
+}
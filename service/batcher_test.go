@@ -0,0 +1,182 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cdr/config"
+)
+
+// batchRecorder 记录批量发送器发送的每一批
+type batchRecorder struct {
+	batches [][]*pendingDelivery
+	mutex   sync.Mutex
+}
+
+func (r *batchRecorder) flush(items []*pendingDelivery) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.batches = append(r.batches, items)
+}
+
+// sizes 返回每一批的记录数
+func (r *batchRecorder) sizes() []int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	sizes := make([]int, len(r.batches))
+	for i, batch := range r.batches {
+		sizes[i] = len(batch)
+	}
+	return sizes
+}
+
+// testBatcher 创建批量发送器，等待时间足够长，只按条数、字节数或 Flush 发送
+func testBatcher(maxCount, maxBytes int, format string) (*Batcher, *batchRecorder) {
+	cfg := &config.Config{}
+	cfg.Push.Batch.MaxCount = maxCount
+	cfg.Push.Batch.MaxBytes = maxBytes
+	cfg.Push.Batch.LingerMs = int(time.Hour / time.Millisecond)
+	cfg.Push.Batch.Format = format
+	recorder := &batchRecorder{}
+	return NewBatcher(cfg, recorder.flush), recorder
+}
+
+// batchItem 创建指定字节数的CDR推送
+func batchItem(url string, size int) *pendingDelivery {
+	return &pendingDelivery{
+		delivery: &Delivery{
+			Kind:    DeliveryKindCDR,
+			Account: "TEST_ACCOUNT",
+			URL:     url,
+			Payload: []byte(`"` + strings.Repeat("x", size-2) + `"`),
+		},
+		result: make(chan error, 1),
+	}
+}
+
+func equalSizes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBatcherSplits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxCount int
+		maxBytes int
+		format   string
+		sizes    []int // 依次加入的记录字节数
+		want     []int // 每批的记录数，最后一批由 Flush 发送
+	}{
+		// JSON数组：方括号2字节，记录之间1个逗号，两条10字节的记录共23字节
+		{"按条数", 3, 1000, BatchFormatJSON, []int{10, 10, 10, 10, 10}, []int{3, 2}},
+		{"恰好达到字节数上限", 100, 23, BatchFormatJSON, []int{10, 10, 10}, []int{2, 1}},
+		{"超过字节数上限前先发送", 100, 30, BatchFormatJSON, []int{10, 10, 10}, []int{2, 1}},
+		{"大记录另起一批", 100, 30, BatchFormatJSON, []int{10, 20, 5}, []int{1, 2}},
+		{"单条记录超过上限单独发送", 100, 30, BatchFormatJSON, []int{10, 50, 10}, []int{1, 1, 1}},
+		// NDJSON：每条记录后1个换行，两条10字节的记录共22字节
+		{"NDJSON恰好达到字节数上限", 100, 22, BatchFormatNDJSON, []int{10, 10, 10}, []int{2, 1}},
+		{"NDJSON超过字节数上限前先发送", 100, 21, BatchFormatNDJSON, []int{10, 10, 10}, []int{1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, recorder := testBatcher(tt.maxCount, tt.maxBytes, tt.format)
+			for _, size := range tt.sizes {
+				b.Add(batchItem("http://localhost/cdr", size))
+			}
+			b.Flush()
+
+			if got := recorder.sizes(); !equalSizes(got, tt.want) {
+				t.Fatalf("各批记录数为 %v, 期望 %v", got, tt.want)
+			}
+			// 多条记录的批次编码后不超过字节数上限
+			for _, batch := range recorder.batches {
+				body, _ := encodeBatch(batch, tt.format)
+				if len(batch) > 1 && len(body) > tt.maxBytes {
+					t.Fatalf("%d条记录的请求体为%d字节, 超过上限%d", len(batch), len(body), tt.maxBytes)
+				}
+			}
+		})
+	}
+}
+
+func TestBatcherSeparatesEndpoints(t *testing.T) {
+	b, recorder := testBatcher(2, 1000, BatchFormatJSON)
+	b.Add(batchItem("http://a/cdr", 10))
+	b.Add(batchItem("http://b/cdr", 10))
+	b.Add(batchItem("http://a/cdr", 10))
+	if got := recorder.sizes(); !equalSizes(got, []int{2}) {
+		t.Fatalf("各批记录数为 %v, 期望 [2]", got)
+	}
+	for _, item := range recorder.batches[0] {
+		if item.delivery.URL != "http://a/cdr" {
+			t.Fatalf("批次中混入了 %s 的记录", item.delivery.URL)
+		}
+	}
+}
+
+func TestBatcherStaleLingerTimer(t *testing.T) {
+	b, recorder := testBatcher(2, 1000, BatchFormatJSON)
+	item := batchItem("http://localhost/cdr", 10)
+	key := batchKey{item.delivery.Account, item.delivery.URL}
+
+	b.Add(item)
+	b.mutex.Lock()
+	stale := b.batches[key]
+	b.mutex.Unlock()
+
+	// 第一批因满额提前发送，同一推送地址开始积累新的批次
+	b.Add(batchItem("http://localhost/cdr", 10))
+	b.Add(batchItem("http://localhost/cdr", 10))
+
+	// 第一批的等待计时到期，不应提前发送新的批次
+	b.flushBatch(key, stale)
+	if got := recorder.sizes(); !equalSizes(got, []int{2}) {
+		t.Fatalf("各批记录数为 %v, 期望 [2]", got)
+	}
+
+	b.mutex.Lock()
+	current := b.batches[key]
+	b.mutex.Unlock()
+	b.flushBatch(key, current)
+	if got := recorder.sizes(); !equalSizes(got, []int{2, 1}) {
+		t.Fatalf("各批记录数为 %v, 期望 [2 1]", got)
+	}
+}
+
+func TestBatcherLinger(t *testing.T) {
+	b, recorder := testBatcher(100, 1000, BatchFormatJSON)
+	b.linger = 20 * time.Millisecond
+	b.Add(batchItem("http://localhost/cdr", 10))
+	b.Add(batchItem("http://localhost/cdr", 10))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(recorder.sizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := recorder.sizes(); !equalSizes(got, []int{2}) {
+		t.Fatalf("各批记录数为 %v, 期望 [2]", got)
+	}
+}
+
+func TestBatcherClose(t *testing.T) {
+	b, recorder := testBatcher(100, 1000, BatchFormatJSON)
+	b.Add(batchItem("http://localhost/cdr", 10))
+	b.Close()
+
+	// 关闭后加入的记录立即单独发送
+	b.Add(batchItem("http://localhost/cdr", 10))
+	if got := recorder.sizes(); !equalSizes(got, []int{1, 1}) {
+		t.Fatalf("各批记录数为 %v, 期望 [1 1]", got)
+	}
+}
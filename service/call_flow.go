@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"cdr/config"
+	"cdr/models"
+)
+
+// 内置的通话结局
+const (
+	OutcomeAnswered     = "answered"      // 正常接通后挂机
+	OutcomeBusy         = "busy"          // 被叫忙
+	OutcomeNoAnswer     = "no_answer"     // 振铃超时无人接听
+	OutcomeRejected     = "rejected"      // 被叫振铃中拒接
+	OutcomeCallerCancel = "caller_cancel" // 主叫振铃中挂机
+	OutcomePowerOff     = "power_off"     // 被叫关机
+	OutcomeSuspended    = "suspended"     // 被叫停机
+	OutcomeUnbound      = "unbound"       // 隐私号绑定已过期，平台直接释放
+)
+
+// FlowDelay 流程步骤相对上一事件的间隔类型，具体时长取自 simulation 配置
+type FlowDelay int
+
+const (
+	DelayNone     FlowDelay = iota // 无间隔
+	DelayRing                      // 呼叫到振铃，1~max_ring_delay秒
+	DelayAnswer                    // 振铃到接听/拒接，1~max_answer_delay秒
+	DelayTalk                      // 通话时长，1~max_talk_duration秒
+	DelayNoAnswer                  // 振铃超时，固定no_answer_timeout秒
+)
+
+// FlowStep 通话流程中的一个事件
+type FlowStep struct {
+	EventType int
+	Delay     FlowDelay
+}
+
+// CallFlow 一种通话结局对应的事件流程，决定状态推送序列以及话单的通话结果
+type CallFlow struct {
+	Outcome     string
+	Steps       []FlowStep
+	CallResult  int
+	ReleaseType int // 释放方，为0时在主叫与被叫中随机
+}
+
+var (
+	callFlows     = make(map[string]*CallFlow)
+	callFlowsLock sync.RWMutex
+)
+
+// RegisterCallFlow 注册通话流程，同名流程会被覆盖
+func RegisterCallFlow(flow *CallFlow) error {
+	if flow.Outcome == "" {
+		return fmt.Errorf("通话流程缺少结局名称")
+	}
+	if len(flow.Steps) < 2 || flow.Steps[0].EventType != models.EventTypeCalling ||
+		flow.Steps[len(flow.Steps)-1].EventType != models.EventTypeEnded {
+		return fmt.Errorf("通话流程%s必须以呼叫中开始、以已结束结束", flow.Outcome)
+	}
+
+	callFlowsLock.Lock()
+	defer callFlowsLock.Unlock()
+	callFlows[flow.Outcome] = flow
+	return nil
+}
+
+// lookupCallFlow 按结局名称查找通话流程
+func lookupCallFlow(outcome string) (*CallFlow, bool) {
+	callFlowsLock.RLock()
+	defer callFlowsLock.RUnlock()
+	flow, ok := callFlows[outcome]
+	return flow, ok
+}
+
+func init() {
+	calling := FlowStep{EventType: models.EventTypeCalling, Delay: DelayNone}
+	ringing := FlowStep{EventType: models.EventTypeRinging, Delay: DelayRing}
+
+	for _, flow := range []*CallFlow{
+		{
+			Outcome: OutcomeAnswered,
+			Steps: []FlowStep{calling, ringing,
+				{EventType: models.EventTypeAnswered, Delay: DelayAnswer},
+				{EventType: models.EventTypeEnded, Delay: DelayTalk}},
+			CallResult: models.CallResultAnswered,
+		},
+		{
+			Outcome:     OutcomeBusy,
+			Steps:       []FlowStep{calling, {EventType: models.EventTypeEnded, Delay: DelayRing}},
+			CallResult:  models.CallResultBusy,
+			ReleaseType: models.ReleaseTypeNetwork,
+		},
+		{
+			Outcome:     OutcomeNoAnswer,
+			Steps:       []FlowStep{calling, ringing, {EventType: models.EventTypeEnded, Delay: DelayNoAnswer}},
+			CallResult:  models.CallResultNoAnswer,
+			ReleaseType: models.ReleaseTypeNetwork,
+		},
+		{
+			Outcome:     OutcomeRejected,
+			Steps:       []FlowStep{calling, ringing, {EventType: models.EventTypeEnded, Delay: DelayAnswer}},
+			CallResult:  models.CallResultRejected,
+			ReleaseType: models.ReleaseTypeCallee,
+		},
+		{
+			Outcome:     OutcomeCallerCancel,
+			Steps:       []FlowStep{calling, ringing, {EventType: models.EventTypeEnded, Delay: DelayAnswer}},
+			CallResult:  models.CallResultCallerCancel,
+			ReleaseType: models.ReleaseTypeCaller,
+		},
+		{
+			Outcome:     OutcomePowerOff,
+			Steps:       []FlowStep{calling, {EventType: models.EventTypeEnded, Delay: DelayRing}},
+			CallResult:  models.CallResultPowerOff,
+			ReleaseType: models.ReleaseTypeNetwork,
+		},
+		{
+			Outcome:     OutcomeSuspended,
+			Steps:       []FlowStep{calling, {EventType: models.EventTypeEnded, Delay: DelayRing}},
+			CallResult:  models.CallResultSuspended,
+			ReleaseType: models.ReleaseTypeNetwork,
+		},
+		{
+			Outcome:     OutcomeUnbound,
+			Steps:       []FlowStep{calling, {EventType: models.EventTypeEnded, Delay: DelayRing}},
+			CallResult:  models.CallResultUnbound,
+			ReleaseType: models.ReleaseTypeNetwork,
+		},
+	} {
+		if err := RegisterCallFlow(flow); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// flowDelay 根据配置计算步骤间隔
+func flowDelay(delay FlowDelay, cfg *config.Config) time.Duration {
+	sim := cfg.Simulation
+	switch delay {
+	case DelayRing:
+		return randomSeconds(sim.MaxRingDelay)
+	case DelayAnswer:
+		return randomSeconds(sim.MaxAnswerDelay)
+	case DelayTalk:
+		return randomSeconds(sim.MaxTalkDuration)
+	case DelayNoAnswer:
+		return time.Duration(sim.NoAnswerTimeout) * time.Second
+	default:
+		return 0
+	}
+}
+
+// callFlowSelector 按配置的权重随机选择通话结局
+type callFlowSelector struct {
+	flows   []*CallFlow
+	weights []int // 累计权重
+	total   int
+}
+
+// newCallFlowSelector 根据结局权重创建选择器
+func newCallFlowSelector(outcomes map[string]int) (*callFlowSelector, error) {
+	// 按名称排序，保证相同配置下的选择顺序稳定
+	names := make([]string, 0, len(outcomes))
+	for name := range outcomes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	selector := &callFlowSelector{}
+	for _, name := range names {
+		weight := outcomes[name]
+		if weight < 0 {
+			return nil, fmt.Errorf("通话结局%s的权重不能为负数", name)
+		}
+		if weight == 0 {
+			continue
+		}
+		flow, ok := lookupCallFlow(name)
+		if !ok {
+			return nil, fmt.Errorf("未知的通话结局: %s", name)
+		}
+		selector.total += weight
+		selector.flows = append(selector.flows, flow)
+		selector.weights = append(selector.weights, selector.total)
+	}
+	if selector.total == 0 {
+		return nil, fmt.Errorf("通话结局权重总和必须大于0")
+	}
+	return selector, nil
+}
+
+// pick 随机选择一个通话流程
+func (s *callFlowSelector) pick() *CallFlow {
+	n := rand.Intn(s.total)
+	i := sort.SearchInts(s.weights, n+1)
+	return s.flows[i]
+}
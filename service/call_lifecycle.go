@@ -0,0 +1,194 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"cdr/config"
+	"cdr/models"
+)
+
+// callInfo 记录一个模拟通话的完整生命周期
+//
+// 所有事件时间在发起呼叫时按通话流程一次性规划好，并截断到秒，
+// 保证状态推送中的eventTime（秒）与话单中的毫秒时间戳完全一致。
+type callInfo struct {
+	status      *models.CallStatus
+	flow        *CallFlow
+	eventIndex  int         // 当前事件在flow.Steps中的位置
+	eventTimes  []time.Time // 与flow.Steps一一对应的计划时间
+	releaseType int
+	route       *PrivacyRoute // 隐私号路由，非隐私号模式为nil
+	nextAt      time.Time     // 下一个事件的计划时间
+	queueIndex  int           // 在callQueue中的位置
+}
+
+// newCallInfo 创建通话并按流程规划各事件的时间
+func newCallInfo(status *models.CallStatus, flow *CallFlow, route *PrivacyRoute, begin time.Time, cfg *config.Config) *callInfo {
+	info := &callInfo{
+		status:      status,
+		flow:        flow,
+		route:       route,
+		eventTimes:  make([]time.Time, len(flow.Steps)),
+		releaseType: flow.ReleaseType,
+	}
+
+	at := begin.Truncate(time.Second)
+	for i, step := range flow.Steps {
+		at = at.Add(flowDelay(step.Delay, cfg))
+		info.eventTimes[i] = at
+	}
+	info.nextAt = info.eventTimes[1]
+
+	if info.releaseType == 0 {
+		info.releaseType = models.ReleaseTypeCaller + rand.Intn(2)
+	}
+	return info
+}
+
+// randomSeconds 返回1到max秒之间的随机时长
+func randomSeconds(max int) time.Duration {
+	if max <= 1 {
+		return time.Second
+	}
+	return time.Duration(rand.Intn(max)+1) * time.Second
+}
+
+// eventTime 返回指定事件的计划发生时间，流程中没有该事件时返回零值
+func (c *callInfo) eventTime(eventType int) time.Time {
+	for i, step := range c.flow.Steps {
+		if step.EventType == eventType {
+			return c.eventTimes[i]
+		}
+	}
+	return time.Time{}
+}
+
+// advance 推进到流程中的下一个事件，返回是否已结束
+func (c *callInfo) advance() bool {
+	c.eventIndex++
+	step := c.flow.Steps[c.eventIndex]
+	c.status.EventType = step.EventType
+	c.status.AllEventType = append(c.status.AllEventType, step.EventType)
+	c.status.EventTime = formatEventTime(c.eventTimes[c.eventIndex])
+
+	if c.eventIndex == len(c.flow.Steps)-1 {
+		return true
+	}
+	c.nextAt = c.eventTimes[c.eventIndex+1]
+	return false
+}
+
+// forceEnd 在计划时间之前由平台结束通话，跳过尚未发生的事件，推进到已结束
+//
+// 平台释放的通话只按是否已接通决定结果：已接通的按正常接通计算时长，
+// 尚未接通的一律按无人接听结束，不沿用原计划的忙、拒接、主叫挂机等结局。
+func (c *callInfo) forceEnd(now time.Time) {
+	end := now.Truncate(time.Second)
+	if last := c.eventTimes[c.eventIndex]; end.Before(last) {
+		end = last
+	}
+
+	answered := false
+	for _, step := range c.flow.Steps[:c.eventIndex+1] {
+		if step.EventType == models.EventTypeAnswered {
+			answered = true
+		}
+	}
+
+	flow := *c.flow
+	flow.Steps = append(append([]FlowStep(nil), c.flow.Steps[:c.eventIndex+1]...), c.flow.Steps[len(c.flow.Steps)-1])
+	flow.CallResult = models.CallResultNoAnswer
+	if answered {
+		flow.CallResult = models.CallResultAnswered
+	}
+	c.flow = &flow
+	c.eventTimes = append(c.eventTimes[:c.eventIndex+1:c.eventIndex+1], end)
+	c.releaseType = models.ReleaseTypeNetwork
+	c.advance()
+}
+
+// formatEventTime 格式化状态推送中的事件时间（秒）
+func formatEventTime(t time.Time) string {
+	return fmt.Sprintf("%d", t.Unix())
+}
+
+// snapshot 复制当前状态用于推送，避免推送过程中被并发修改
+func (c *callInfo) snapshot() *models.CallStatus {
+	status := *c.status
+	status.AllEventType = append([]int(nil), c.status.AllEventType...)
+	return &status
+}
+
+// buildCDR 根据通话生命周期生成话单，字段与状态推送保持一致
+func (c *callInfo) buildCDR() *models.CDR {
+	status := c.status
+	begin := c.eventTimes[0]
+	end := c.eventTimes[len(c.eventTimes)-1]
+
+	cdr := &models.CDR{
+		AccountID:      status.AccountID,
+		CallID:         status.CallID,
+		ServiceType:    status.ServiceType,
+		Caller:         status.Caller,
+		Callee:         status.Callee,
+		BeginCallTime:  toMillis(begin),
+		RingTime:       toMillis(c.eventTime(models.EventTypeRinging)),
+		EndTime:        toMillis(end),
+		ReleaseType:    c.releaseType,
+		CallResult:     c.flow.CallResult,
+		CDRCreateTime:  time.Now().UnixNano() / 1e6,
+		SubscriptionID: status.SubscriptionID,
+		MessageType:    status.MessageType,
+		CDRType:        1,
+		UserData:       status.UserData,
+	}
+
+	// 未接通的通话没有应答时间，通话时长为0
+	if answer := c.eventTime(models.EventTypeAnswered); !answer.IsZero() {
+		cdr.StartTime = toMillis(answer)
+		cdr.CallDuration = int(end.Sub(answer) / time.Second)
+	}
+	if c.route != nil {
+		c.route.applyToCDR(cdr)
+	}
+	return cdr
+}
+
+// toMillis 转换为毫秒时间戳，零值返回0
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / 1e6
+}
+
+// callQueue 按下一个事件时间排序的最小堆，实现 heap.Interface
+type callQueue []*callInfo
+
+func (q callQueue) Len() int { return len(q) }
+
+func (q callQueue) Less(i, j int) bool { return q[i].nextAt.Before(q[j].nextAt) }
+
+func (q callQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].queueIndex = i
+	q[j].queueIndex = j
+}
+
+func (q *callQueue) Push(x any) {
+	info := x.(*callInfo)
+	info.queueIndex = len(*q)
+	*q = append(*q, info)
+}
+
+func (q *callQueue) Pop() any {
+	old := *q
+	n := len(old)
+	info := old[n-1]
+	old[n-1] = nil
+	info.queueIndex = -1
+	*q = old[:n-1]
+	return info
+}
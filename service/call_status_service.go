@@ -1,12 +1,15 @@
 package service
 
 import (
-	"bytes"
+	"container/heap"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
+	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"cdr/config"
@@ -15,159 +18,338 @@ import (
 
 // CallStatusService 处理呼叫状态推送的业务逻辑
 type CallStatusService struct {
-	config       *config.Config
-	cdrService   *CDRService          // 用于生成号码等功能
-	currentCalls map[string]*callInfo // 记录当前进行中的通话
-	logger       *Logger              // 日志记录器
-	workerPool   *WorkerPool          // 工作池
-	mutex        sync.Mutex           // 用于保护 currentCalls map 的并发访问
+	config       atomic.Pointer[config.Config]
+	cdrService   *CDRService           // 用于生成号码等功能
+	currentCalls map[string]*callInfo  // 记录当前进行中的通话
+	callQueue    callQueue             // 按下一个事件时间排序的通话队列
+	flows        *callFlowSelector     // 通话结局选择器
+	outcomes     map[string]int        // 当前通话结局的权重
+	load         *LoadShaper           // 控制新建呼叫的速率
+	logger       *Logger               // 日志记录器
+	pusher       *Pusher               // 推送器
+	subscribers  *SubscriptionRegistry // 状态事件订阅表
+	lastUpdate   int64                 // 最近一次推进呼叫状态的时间（UnixNano）
+	reserved     int                   // 已占用名额、尚未加入 currentCalls 的新呼叫数
+	mutex        sync.Mutex            // 用于保护 currentCalls map 的并发访问
 }
 
-type callInfo struct {
-	status     *models.CallStatus
-	eventIndex int
-	startTime  time.Time
-}
+// ErrTooManyCalls 进行中的通话数已达上限
+var ErrTooManyCalls = errors.New("进行中的通话数已达上限")
 
 // NewCallStatusService 创建呼叫状态服务实例
-func NewCallStatusService(cfg *config.Config, cdrService *CDRService) *CallStatusService {
+func NewCallStatusService(cfg *config.Config, cdrService *CDRService, pusher *Pusher) (*CallStatusService, error) {
+	flows, err := newCallFlowSelector(cfg.Simulation.Outcomes)
+	if err != nil {
+		return nil, fmt.Errorf("通话结局配置错误: %v", err)
+	}
+
+	load, err := NewLoadShaper(cfg, cfg.Rate.NewCall)
+	if err != nil {
+		return nil, fmt.Errorf("流量曲线配置错误: %v", err)
+	}
+
 	logger, err := NewLogger("status")
 	if err != nil {
 		log.Printf("初始化日志记录器失败: %v", err)
+	} else {
+		pusher.SetLogger(DeliveryKindStatus, logger.LogPushStatus)
 	}
 
-	return &CallStatusService{
-		config:       cfg,
+	s := &CallStatusService{
 		cdrService:   cdrService,
 		currentCalls: make(map[string]*callInfo),
+		flows:        flows,
+		outcomes:     cfg.Simulation.Outcomes,
+		load:         load,
 		logger:       logger,
-		workerPool:   NewWorkerPool(cfg.Push.Workers),
+		pusher:       pusher,
+		subscribers:  NewSubscriptionRegistry(cfg.Subscriptions),
+		lastUpdate:   time.Now().UnixNano(),
 	}
+	s.config.Store(cfg)
+	return s, nil
 }
 
-// StartNewCall 开始一个新的呼叫并推送第一个状态
-func (s *CallStatusService) StartNewCall() error {
-	// 生成新的呼叫信息
-	status := &models.CallStatus{
-		AccountID:      s.config.Account.ID,
-		CallID:         s.cdrService.GenerateCallID(),
-		ServiceType:    s.config.Account.ServiceType,
-		Caller:         s.cdrService.GeneratePhoneNumber(),
-		Callee:         s.cdrService.GeneratePhoneNumber(),
-		EventTime:      fmt.Sprintf("%d", time.Now().Unix()),
-		EventType:      models.EventTypeCalling,
-		AllEventType:   []int{models.EventTypeCalling},
-		MessageType:    1,
-		Party:          1,
-		SubscriptionID: "sim_" + time.Now().Format("20060102150405"),
-		UserData:       fmt.Sprintf("{\"startTime\":\"%d\"}", time.Now().Unix()),
+// Load 返回控制新建呼叫速率的流量控制器，调用方按其限速器的节奏调用 StartNewCall
+func (s *CallStatusService) Load() *LoadShaper {
+	return s.load
+}
+
+// ApplyConfig 应用重新加载的配置，通话结局权重、新建呼叫速率和订阅只在配置值修改时替换
+//
+// 通话结局权重需事先通过 CheckConfig 校验。订阅修改后整体替换，管理接口添加或删除的订阅不再保留。
+func (s *CallStatusService) ApplyConfig(cfg *config.Config) {
+	old := s.config.Swap(cfg)
+	if !reflect.DeepEqual(cfg.Simulation.Outcomes, old.Simulation.Outcomes) {
+		if err := s.SetOutcomes(cfg.Simulation.Outcomes); err != nil {
+			log.Printf("应用通话结局权重失败: %v", err)
+		}
+	}
+	if cfg.Rate.NewCall != old.Rate.NewCall {
+		s.load.SetBase(cfg.Rate.NewCall)
 	}
+	if !reflect.DeepEqual(cfg.Subscriptions, old.Subscriptions) {
+		s.subscribers.Replace(cfg.Subscriptions)
+	}
+}
 
-	// 保存呼叫信息
-	s.mutex.Lock()
-	s.currentCalls[status.CallID] = &callInfo{
-		status:     status,
-		eventIndex: 0,
-		startTime:  time.Now(),
+// Subscriptions 返回状态事件订阅表
+func (s *CallStatusService) Subscriptions() *SubscriptionRegistry {
+	return s.subscribers
+}
+
+// SetOutcomes 替换通话结局的权重，对之后新建的呼叫生效，进行中的呼叫按原流程结束
+func (s *CallStatusService) SetOutcomes(outcomes map[string]int) error {
+	flows, err := newCallFlowSelector(outcomes)
+	if err != nil {
+		return fmt.Errorf("通话结局配置错误: %v", err)
 	}
+	s.mutex.Lock()
+	s.flows = flows
+	s.outcomes = outcomes
 	s.mutex.Unlock()
-
-	// 推送第一个状态
-	return s.pushStatus(status)
+	return nil
 }
 
-// UpdateCallStatus 更新现有呼叫的状态
-func (s *CallStatusService) UpdateCallStatus() error {
+// Outcomes 返回当前通话结局的权重
+func (s *CallStatusService) Outcomes() map[string]int {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
-	for callID, info := range s.currentCalls {
-		// 如果通话已经结束，从map中删除
-		if info.status.EventType == models.EventTypeEnded {
-			delete(s.currentCalls, callID)
-			continue
+	outcomes := make(map[string]int, len(s.outcomes))
+	for outcome, weight := range s.outcomes {
+		outcomes[outcome] = weight
+	}
+	return outcomes
+}
+
+// Burst 不受速率限制立即发起n个呼叫，达到并发上限或ctx取消时停止，返回实际发起的呼叫数
+func (s *CallStatusService) Burst(ctx context.Context, n int) (int, error) {
+	for i := 0; i < n; i++ {
+		if err := s.StartNewCall(ctx); err != nil {
+			if errors.Is(err, ErrTooManyCalls) {
+				return i, nil
+			}
+			return i, err
 		}
+	}
+	return n, nil
+}
 
-		// 获取下一个状态
-		nextEventType := s.getNextEventType(info.status.EventType)
-		info.status.EventType = nextEventType
-		info.status.AllEventType = append(info.status.AllEventType, nextEventType)
-		info.status.EventTime = fmt.Sprintf("%d", time.Now().Unix())
-		info.eventIndex++
+// Run 每100毫秒推进一次已到计划时间的呼叫状态，直到ctx取消
+//
+// 事件时间精确到秒，结束的呼叫会同时推送话单。ctx只控制循环的停止，
+// 已推进的状态必须送达，推送使用不随ctx取消的上下文。
+func (s *CallStatusService) Run(ctx context.Context) {
+	pushCtx := context.WithoutCancel(ctx)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := s.UpdateCallStatus(pushCtx); err != nil {
+			log.Printf("更新呼叫状态失败: %v", err)
+		}
+	}
+}
 
-		// 推送状态
-		if err := s.pushStatus(info.status); err != nil {
-			log.Printf("推送状态失败 CallID:%s, Error:%v", callID, err)
+// Drain 等待进行中的通话按计划结束，ctx结束后强制结束剩余通话，返回强制结束的通话数
+//
+// 调用前应停止新建呼叫，并保持 Run 继续运行。强制结束的推送不随ctx取消。
+func (s *CallStatusService) Drain(ctx context.Context) int {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for s.ActiveCalls() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return s.ForceEndAll(context.WithoutCancel(ctx))
 		}
 	}
-	return nil
+	return 0
 }
 
-// getNextEventType 获取下一个状态
-func (s *CallStatusService) getNextEventType(currentType int) int {
-	switch currentType {
-	case models.EventTypeCalling:
-		return models.EventTypeRinging
-	case models.EventTypeRinging:
-		return models.EventTypeAnswered
-	case models.EventTypeAnswered:
-		return models.EventTypeEnded
-	default:
-		return models.EventTypeEnded
+// ForceEndAll 立即结束所有进行中的通话，使用ctx推送已结束状态和话单，返回结束的通话数
+func (s *CallStatusService) ForceEndAll(ctx context.Context) int {
+	now := time.Now()
+	var updates []callUpdate
+
+	s.mutex.Lock()
+	for _, info := range s.currentCalls {
+		info.forceEnd(now)
+		updates = append(updates, callUpdate{status: info.snapshot(), cdr: info.buildCDR()})
+	}
+	s.currentCalls = make(map[string]*callInfo)
+	s.callQueue = nil
+	s.mutex.Unlock()
+
+	for _, update := range updates {
+		log.Printf("强制结束通话 CallID:%s", update.status.CallID)
+		s.pushStatus(ctx, update.status)
+		s.cdrService.PushCDR(ctx, update.cdr)
 	}
+	return len(updates)
 }
 
-// pushStatus 推送状态（带重试机制）
-func (s *CallStatusService) pushStatus(status *models.CallStatus) error {
-	jsonData, err := json.Marshal(status)
-	if err != nil {
-		return fmt.Errorf("JSON序列化失败: %v", err)
+// Close 停止流量控制器并关闭日志文件，需在推送器关闭之后调用
+func (s *CallStatusService) Close() error {
+	s.load.Close()
+	if s.logger == nil {
+		return nil
 	}
+	return s.logger.Close()
+}
 
-	// 记录推送的URL
-	pushURL := s.config.Push.StatusURL
+// ActiveCalls 返回进行中的通话数
+func (s *CallStatusService) ActiveCalls() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.currentCalls)
+}
 
-	// 创建错误通道用于收集推送结果
-	errChan := make(chan error, 1)
+// LastUpdate 返回最近一次推进呼叫状态的时间，用于检测状态推进循环是否卡死
+func (s *CallStatusService) LastUpdate() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&s.lastUpdate))
+}
 
-	// 提交推送任务到工作池
-	s.workerPool.Submit(func() {
-		var lastErr error
-		for i := 0; i < s.config.Retry.Times; i++ {
-			if i > 0 {
-				delay := s.config.Retry.Delays[i]
-				log.Printf("状态推送重试 CallID:%s, 第%d次, 等待%d秒...", status.CallID, i, delay)
-				time.Sleep(time.Duration(delay) * time.Second)
-			}
+// StartNewCall 开始一个新的呼叫并使用ctx推送第一个状态，ctx已取消时不发起呼叫
+func (s *CallStatusService) StartNewCall(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-			resp, err := http.Post(pushURL, "application/json", bytes.NewBuffer(jsonData))
-			if err != nil {
-				lastErr = fmt.Errorf("HTTP请求失败: %v", err)
-				log.Printf("状态推送失败: %v", lastErr)
-				// 记录失败日志
-				if s.logger != nil {
-					s.logger.LogPushStatus(status.CallID, pushURL, jsonData, 0, lastErr)
-				}
-				continue
-			}
-			defer resp.Body.Close()
+	// 先占用并发名额，达到上限的呼叫不再选路，不消耗隐私号绑定
+	s.mutex.Lock()
+	if len(s.currentCalls)+s.reserved >= s.config.Load().Simulation.MaxActiveCalls {
+		s.mutex.Unlock()
+		return ErrTooManyCalls
+	}
+	s.reserved++
+	s.mutex.Unlock()
 
-			// 记录推送结果
-			if s.logger != nil {
-				s.logger.LogPushStatus(status.CallID, pushURL, jsonData, resp.StatusCode, nil)
-			}
+	now := time.Now()
+	account := pickAccount(s.config.Load())
+	serviceType := s.cdrService.ServiceTypeFor(account)
 
-			if resp.StatusCode == http.StatusOK {
-				log.Printf("状态推送成功 CallID:%s, EventType:%d", status.CallID, status.EventType)
-				errChan <- nil
-				return
-			}
+	// 生成新的呼叫信息，账号按权重选择
+	status := &models.CallStatus{
+		AccountID:      account.ID,
+		CallID:         s.cdrService.GenerateCallID(),
+		ServiceType:    serviceType,
+		Caller:         s.cdrService.GeneratePhoneNumber(),
+		Callee:         s.cdrService.GeneratePhoneNumber(),
+		EventType:      models.EventTypeCalling,
+		AllEventType:   []int{models.EventTypeCalling},
+		MessageType:    1,
+		Party:          1,
+		SubscriptionID: "sim_" + now.Format("20060102150405"),
+		UserData:       fmt.Sprintf("{\"startTime\":\"%d\"}", now.Unix()),
+	}
+	// 选择本次通话的结局，隐私号模式下绑定过期的呼叫直接失败
+	s.mutex.Lock()
+	flow := s.flows.pick()
+	s.mutex.Unlock()
+	route := s.cdrService.RoutePrivacyCall(serviceType, now)
+	if route != nil {
+		route.applyToStatus(status)
+		if route.Expired {
+			flow, _ = lookupCallFlow(OutcomeUnbound)
+		}
+	}
 
-			lastErr = fmt.Errorf("推送失败，状态码: %d", resp.StatusCode)
-			log.Printf("状态推送失败: %v", lastErr)
+	// 规划事件时间
+	info := newCallInfo(status, flow, route, now, s.config.Load())
+	status.EventTime = formatEventTime(info.eventTimes[0])
+
+	// 保存呼叫信息，释放占用的名额
+	s.mutex.Lock()
+	s.reserved--
+	s.currentCalls[status.CallID] = info
+	heap.Push(&s.callQueue, info)
+	snapshot := info.snapshot()
+	s.mutex.Unlock()
+
+	// 推送第一个状态，投递结果由推送器异步记录
+	s.pushStatus(ctx, snapshot)
+	return nil
+}
+
+// callUpdate 一次状态推进产生的推送内容
+type callUpdate struct {
+	status *models.CallStatus
+	cdr    *models.CDR // 通话结束时生成的话单
+}
+
+// UpdateCallStatus 推进所有已到计划时间的呼叫状态
+//
+// 通话结束时会根据生命周期生成话单并推送，话单的callId、主被叫
+// 以及各时间点与状态推送完全一致。推送使用ctx，ctx已取消时不推进。
+func (s *CallStatusService) UpdateCallStatus(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now()
+	atomic.StoreInt64(&s.lastUpdate, now.UnixNano())
+	var updates []callUpdate
+
+	s.mutex.Lock()
+	for s.callQueue.Len() > 0 && !s.callQueue[0].nextAt.After(now) {
+		info := heap.Pop(&s.callQueue).(*callInfo)
+
+		// 按通话流程推进到下一个状态
+		ended := info.advance()
+		update := callUpdate{status: info.snapshot()}
+		if ended {
+			// 通话已经结束，从map中删除并生成话单
+			delete(s.currentCalls, info.status.CallID)
+			update.cdr = info.buildCDR()
+		} else {
+			heap.Push(&s.callQueue, info)
+		}
+		updates = append(updates, update)
+	}
+	s.mutex.Unlock()
+
+	// 提交推送，投递结果由推送器异步记录
+	for _, update := range updates {
+		s.pushStatus(ctx, update.status)
+		if update.cdr != nil {
+			s.cdrService.PushCDR(ctx, update.cdr)
 		}
+	}
+	return nil
+}
+
+// pushStatus 提交状态推送（带重试机制），每个接收方的最终结果通过返回的通道异步送达
+//
+// 配置了 subscriptions 或通过管理接口添加了订阅时，只推送给接收该账号和事件类型的订阅，
+// 每个订阅一份副本，subscriptionId 和 messageType 取订阅的配置，没有订阅匹配时不推送。
+// 配置了 subscriptions 时 push.status_url 可以为空，即使订阅被全部删除也不会改为推送到该地址。
+// 两者都没有时推送到账号的状态推送地址。
+func (s *CallStatusService) pushStatus(ctx context.Context, status *models.CallStatus) []<-chan error {
+	cfg := s.config.Load()
+	if len(cfg.Subscriptions) == 0 && s.subscribers.Len() == 0 {
+		url := cfg.StatusURLFor(cfg.FindAccount(status.AccountID))
+		return []<-chan error{s.submitStatus(ctx, status, url)}
+	}
 
-		errChan <- fmt.Errorf("状态推送重试%d次失败，最后错误: %v", s.config.Retry.Times, lastErr)
-	})
+	var results []<-chan error
+	for _, sub := range s.subscribers.Match(status.AccountID, status.EventType) {
+		event := *status
+		event.SubscriptionID = sub.ID
+		event.MessageType = sub.MessageType
+		results = append(results, s.submitStatus(ctx, &event, sub.URL))
+	}
+	return results
+}
 
-	return <-errChan
+// submitStatus 提交一条状态推送，最终结果通过返回的通道异步送达
+func (s *CallStatusService) submitStatus(ctx context.Context, status *models.CallStatus, url string) <-chan error {
+	jsonData, err := json.Marshal(status)
+	if err != nil {
+		return failedResult(fmt.Errorf("JSON序列化失败: %v", err))
+	}
+	return s.pusher.Push(ctx, DeliveryKindStatus, status.AccountID, status.CallID, url, jsonData)
 }
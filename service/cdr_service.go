@@ -1,13 +1,13 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math/rand"
-	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"cdr/config"
@@ -18,22 +18,71 @@ import (
 
 // CDRService 处理CDR相关的业务逻辑
 type CDRService struct {
-	config *config.Config
-	logger *Logger
-	workerPool *WorkerPool
+	config     atomic.Pointer[config.Config]
+	logger     *Logger
+	pusher     *Pusher
+	load       *LoadShaper // 控制CDR生成的速率
+	numberPool *NumberPool // 隐私号号码池，第一次需要隐私号时创建
+
+	serviceType int // 管理接口设置的业务类型，对所有账号生效，为0时使用各账号配置的业务类型
+	mutex       sync.RWMutex
 }
 
 // NewCDRService 创建CDR服务实例
-func NewCDRService(cfg *config.Config) (*CDRService, error) {
+func NewCDRService(cfg *config.Config, pusher *Pusher) (*CDRService, error) {
 	logger, err := NewLogger("cdr")
 	if err != nil {
 		return nil, fmt.Errorf("创建日志记录器失败: %v", err)
 	}
-	return &CDRService{
-		config:     cfg,
-		logger:     logger,
-		workerPool: NewWorkerPool(cfg.Push.Workers),
-	}, nil
+	pusher.SetLogger(DeliveryKindCDR, logger.LogPushCDR)
+
+	load, err := NewLoadShaper(cfg, cfg.Rate.CDR)
+	if err != nil {
+		return nil, fmt.Errorf("流量曲线配置错误: %v", err)
+	}
+
+	s := &CDRService{
+		logger: logger,
+		pusher: pusher,
+		load:   load,
+	}
+	s.config.Store(cfg)
+	return s, nil
+}
+
+// ApplyConfig 应用重新加载的配置，CDR生成速率只在配置值修改时替换
+func (s *CDRService) ApplyConfig(cfg *config.Config) {
+	old := s.config.Swap(cfg)
+	if cfg.Rate.CDR != old.Rate.CDR {
+		s.load.SetBase(cfg.Rate.CDR)
+	}
+}
+
+// ServiceType 返回管理接口设置的业务类型，为0时各账号使用自己配置的业务类型
+func (s *CDRService) ServiceType() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.serviceType
+}
+
+// SetServiceType 将所有账号切换为指定的业务类型，对之后新建的呼叫和生成的CDR生效，为0时恢复各账号的配置
+func (s *CDRService) SetServiceType(serviceType int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.serviceType = serviceType
+}
+
+// ServiceTypeFor 返回账号当前使用的业务类型
+func (s *CDRService) ServiceTypeFor(account *config.AccountConfig) int {
+	if serviceType := s.ServiceType(); serviceType != 0 {
+		return serviceType
+	}
+	return account.ServiceType
+}
+
+// Load 返回控制CDR生成速率的流量控制器，调用方按其限速器的节奏调用 PushCDR
+func (s *CDRService) Load() *LoadShaper {
+	return s.load
 }
 
 // GenerateCallID 生成唯一的通话ID
@@ -52,16 +101,32 @@ func (s *CDRService) GeneratePhoneNumber() string {
 	return fmt.Sprintf("%s%08d", prefix, number)
 }
 
-// GenerateCDR 生成模拟CDR记录
+// RoutePrivacyCall 隐私号业务下为呼叫选择绑定关系，serviceType 不是隐私号时返回nil
+func (s *CDRService) RoutePrivacyCall(serviceType int, now time.Time) *PrivacyRoute {
+	if serviceType != models.ServiceTypePrivacy {
+		return nil
+	}
+	s.mutex.Lock()
+	if s.numberPool == nil {
+		s.numberPool = NewNumberPool(s.config.Load(), s.GeneratePhoneNumber)
+	}
+	pool := s.numberPool
+	s.mutex.Unlock()
+	return pool.Route(now)
+}
+
+// GenerateCDR 为按权重选择的账号生成模拟CDR记录
 func (s *CDRService) GenerateCDR() *models.CDR {
 	now := time.Now()
+	account := pickAccount(s.config.Load())
+	serviceType := s.ServiceTypeFor(account)
 	beginTime := now.Add(-time.Duration(rand.Intn(3600)) * time.Second)
 	duration := rand.Intn(600) // 最长通话10分钟
 
-	return &models.CDR{
-		AccountID:     s.config.Account.ID,
+	cdr := &models.CDR{
+		AccountID:     account.ID,
 		CallID:        s.GenerateCallID(),
-		ServiceType:   s.config.Account.ServiceType,
+		ServiceType:   serviceType,
 		Caller:        s.GeneratePhoneNumber(),
 		Callee:        s.GeneratePhoneNumber(),
 		BeginCallTime: beginTime.UnixNano() / 1e6,
@@ -74,54 +139,53 @@ func (s *CDRService) GenerateCDR() *models.CDR {
 		MessageType:   1,
 		CDRType:       1,
 	}
+
+	// 隐私号模式下填充绑定信息，绑定已过期的呼叫未接通
+	if route := s.RoutePrivacyCall(serviceType, now); route != nil {
+		route.applyToCDR(cdr)
+		if route.Expired {
+			cdr.StartTime = 0
+			cdr.EndTime = beginTime.UnixNano() / 1e6
+			cdr.CallDuration = 0
+			cdr.CallResult = models.CallResultUnbound
+			cdr.ReleaseType = models.ReleaseTypeNetwork
+		}
+	}
+	return cdr
+}
+
+// Burst 不受速率限制立即生成并推送n条CDR，ctx取消时停止，返回实际提交的条数
+func (s *CDRService) Burst(ctx context.Context, n int) (int, error) {
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		s.PushCDR(ctx, nil)
+	}
+	return n, nil
+}
+
+// Close 停止流量控制器并关闭日志文件，需在推送器关闭之后调用
+func (s *CDRService) Close() error {
+	s.load.Close()
+	return s.logger.Close()
 }
 
-// PushCDR 推送CDR记录
-func (s *CDRService) PushCDR(cdr *models.CDR) error {
+// PushCDR 提交CDR记录推送，最终结果通过返回的通道异步送达
+//
+// cdr为nil时生成一条新的CDR。推送地址和重试计划取CDR所属账号的配置。
+// ctx取消后不再重试，结果为ctx的错误。
+func (s *CDRService) PushCDR(ctx context.Context, cdr *models.CDR) <-chan error {
 	if cdr == nil {
 		cdr = s.GenerateCDR()
 	}
 
 	jsonData, err := json.Marshal(cdr)
 	if err != nil {
-		return fmt.Errorf("JSON序列化失败: %v", err)
+		return failedResult(fmt.Errorf("JSON序列化失败: %v", err))
 	}
 
-	// 创建错误通道用于收集推送结果
-	errChan := make(chan error, 1)
-
-	// 提交推送任务到工作池
-	s.workerPool.Submit(func() {
-		var lastErr error
-		for i := 0; i < s.config.Retry.Times; i++ {
-			if i > 0 {
-				delay := s.config.Retry.Delays[i]
-				log.Printf("CDR推送重试 CallID:%s, 第%d次, 等待%d秒...", cdr.CallID, i, delay)
-				time.Sleep(time.Duration(delay) * time.Second)
-			}
-
-			resp, err := http.Post(s.config.Push.CdrURL, "application/json", bytes.NewBuffer(jsonData))
-			if err != nil {
-				lastErr = fmt.Errorf("HTTP请求失败: %v", err)
-				s.logger.LogPushCDR(cdr.CallID, s.config.Push.CdrURL, jsonData, 0, err)
-				log.Printf("推送失败: %v", lastErr)
-				continue
-			}
-			defer resp.Body.Close()
-
-			s.logger.LogPushCDR(cdr.CallID, s.config.Push.CdrURL, jsonData, resp.StatusCode, nil)
-			if resp.StatusCode == http.StatusOK {
-				log.Printf("CDR推送成功，CallID: %v", cdr.CallID)
-				errChan <- nil
-				return
-			}
-
-			lastErr = fmt.Errorf("推送失败，状态码: %d", resp.StatusCode)
-			log.Printf("推送失败: %v", lastErr)
-		}
-
-		errChan <- fmt.Errorf("CDR推送重试%d次失败，最后错误: %v", s.config.Retry.Times, lastErr)
-	})
-
-	return <-errChan
+	cfg := s.config.Load()
+	url := cfg.CdrURLFor(cfg.FindAccount(cdr.AccountID))
+	return s.pusher.Push(ctx, DeliveryKindCDR, cdr.AccountID, cdr.CallID, url, jsonData)
 }
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"cdr/config"
+)
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"    // 正常放行
+	CircuitOpen     = "open"      // 熔断中，新的投递直接进入重试队列
+	CircuitHalfOpen = "half_open" // 熔断时间结束，放行少量探测请求
+)
+
+// CircuitBreaker 单个推送地址的熔断器
+//
+// 关闭状态下统计最近window次请求的失败率，达到阈值后打开；
+// 打开open_duration秒后进入半开状态，放行half_open_probes个探测请求，
+// 全部成功则关闭，任一失败则重新打开。
+type CircuitBreaker struct {
+	state       string
+	results     []bool // 最近请求是否失败的环形缓冲
+	next        int
+	count       int
+	failures    int
+	openedAt    time.Time
+	probing     int // 半开状态下正在进行的探测请求数
+	probePassed int // 半开状态下已成功的探测请求数
+
+	window        int
+	minRequests   int
+	failureRate   int
+	openDuration  time.Duration
+	halfOpenProbe int
+	mutex         sync.Mutex
+}
+
+// newCircuitBreaker 根据配置创建熔断器
+func newCircuitBreaker(cfg *config.Config) *CircuitBreaker {
+	cb := cfg.Push.CircuitBreaker
+	return &CircuitBreaker{
+		state:         CircuitClosed,
+		results:       make([]bool, cb.Window),
+		window:        cb.Window,
+		minRequests:   cb.MinRequests,
+		failureRate:   cb.FailureRate,
+		openDuration:  time.Duration(cb.OpenDuration) * time.Second,
+		halfOpenProbe: cb.HalfOpenProbes,
+	}
+}
+
+// Allow 判断是否放行一次请求，放行的请求必须调用 Record 记录结果
+func (b *CircuitBreaker) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openDuration {
+		b.state = CircuitHalfOpen
+		b.probing = 0
+		b.probePassed = 0
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		return true
+	case CircuitHalfOpen:
+		if b.probing+b.probePassed < b.halfOpenProbe {
+			b.probing++
+			return true
+		}
+	}
+	return false
+}
+
+// Cancel 放弃已放行但未完成的请求，归还半开状态下占用的探测名额，不计入结果
+func (b *CircuitBreaker) Cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.state == CircuitHalfOpen && b.probing > 0 {
+		b.probing--
+	}
+}
+
+// Record 记录一次请求的结果
+func (b *CircuitBreaker) Record(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case CircuitHalfOpen:
+		if b.probing > 0 {
+			b.probing--
+		}
+		if failed {
+			b.open()
+			return
+		}
+		b.probePassed++
+		if b.probePassed >= b.halfOpenProbe {
+			b.state = CircuitClosed
+			b.reset()
+		}
+	case CircuitClosed:
+		if b.count == b.window {
+			if b.results[b.next] {
+				b.failures--
+			}
+		} else {
+			b.count++
+		}
+		b.results[b.next] = failed
+		b.next = (b.next + 1) % b.window
+		if failed {
+			b.failures++
+		}
+		if b.count >= b.minRequests && b.failures*100 >= b.failureRate*b.count {
+			b.open()
+		}
+	}
+}
+
+// open 打开熔断器，调用方需持有锁
+func (b *CircuitBreaker) open() {
+	b.state = CircuitOpen
+	b.openedAt = time.Now()
+	b.reset()
+}
+
+// reset 清空统计窗口，调用方需持有锁
+func (b *CircuitBreaker) reset() {
+	b.next = 0
+	b.count = 0
+	b.failures = 0
+	for i := range b.results {
+		b.results[i] = false
+	}
+}
+
+// RetryAt 返回未被放行的投递下一次尝试的时间，加入随机抖动避免同时涌入
+func (b *CircuitBreaker) RetryAt() time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	jitter := time.Duration(rand.Intn(1000)) * time.Millisecond
+	if b.state == CircuitOpen {
+		return b.openedAt.Add(b.openDuration).Add(jitter)
+	}
+	return time.Now().Add(time.Second + jitter)
+}
+
+// State 返回熔断器当前状态
+func (b *CircuitBreaker) State() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// CircuitBreakers 按推送地址管理熔断器，CDR与状态推送共用
+//
+// 熔断参数取创建时的配置，push.circuit_breaker 在重新加载时列为需要重启的配置项。
+type CircuitBreakers struct {
+	config   *config.Config
+	breakers map[string]*CircuitBreaker
+	mutex    sync.Mutex
+}
+
+// NewCircuitBreakers 创建熔断器集合
+func NewCircuitBreakers(cfg *config.Config) *CircuitBreakers {
+	return &CircuitBreakers{
+		config:   cfg,
+		breakers: make(map[string]*CircuitBreaker),
+	}
+}
+
+// Get 返回推送地址对应的熔断器，不存在时创建
+func (c *CircuitBreakers) Get(url string) *CircuitBreaker {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	breaker, ok := c.breakers[url]
+	if !ok {
+		breaker = newCircuitBreaker(c.config)
+		c.breakers[url] = breaker
+	}
+	return breaker
+}
+
+// States 返回各推送地址的熔断器状态
+func (c *CircuitBreakers) States() map[string]string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	states := make(map[string]string, len(c.breakers))
+	for url, breaker := range c.breakers {
+		states[url] = breaker.State()
+	}
+	return states
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"cdr/config"
+)
+
+// testBreaker 创建熔断器：统计最近10次请求，至少5次后按50%失败率判断，打开30秒，半开时放行3个探测请求
+func testBreaker() *CircuitBreaker {
+	cfg := &config.Config{}
+	cb := &cfg.Push.CircuitBreaker
+	cb.Enabled = true
+	cb.Window = 10
+	cb.MinRequests = 5
+	cb.FailureRate = 50
+	cb.OpenDuration = 30
+	cb.HalfOpenProbes = 3
+	return newCircuitBreaker(cfg)
+}
+
+// record 依次放行并记录请求结果，true表示失败
+func record(t *testing.T, b *CircuitBreaker, results ...bool) {
+	t.Helper()
+	for _, failed := range results {
+		if !b.Allow() {
+			t.Fatalf("状态 %s 下请求未被放行", b.State())
+		}
+		b.Record(failed)
+	}
+}
+
+// openElapsed 模拟熔断器打开后已经过去 open_duration
+func openElapsed(b *CircuitBreaker) {
+	b.mutex.Lock()
+	b.openedAt = b.openedAt.Add(-b.openDuration)
+	b.mutex.Unlock()
+}
+
+// tripped 返回一个已打开的熔断器
+func tripped(t *testing.T) *CircuitBreaker {
+	t.Helper()
+	b := testBreaker()
+	record(t, b, true, true, true, true, true)
+	if b.State() != CircuitOpen {
+		t.Fatalf("状态为 %s, 期望 %s", b.State(), CircuitOpen)
+	}
+	return b
+}
+
+func TestCircuitBreakerOpens(t *testing.T) {
+	const ok, fail = false, true
+	tests := []struct {
+		name    string
+		results []bool
+		want    string
+	}{
+		{"未达到最少请求数", []bool{fail, fail, fail, fail}, CircuitClosed},
+		{"失败率低于阈值", []bool{fail, ok, fail, ok, ok}, CircuitClosed},
+		{"失败率等于阈值", []bool{ok, ok, fail, fail, ok, fail}, CircuitOpen},
+		{"失败率达到阈值", []bool{ok, fail, ok, fail, fail}, CircuitOpen},
+		{"全部失败", []bool{fail, fail, fail, fail, fail}, CircuitOpen},
+		{"早期失败移出统计窗口", []bool{fail, fail, ok, ok, ok, ok, ok, ok, ok, ok, fail, fail, fail}, CircuitClosed},
+		{"只按统计窗口内的请求计算失败率", []bool{ok, ok, ok, ok, ok, ok, fail, fail, fail, fail, fail}, CircuitOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBreaker()
+			for i, failed := range tt.results {
+				// 打开后不再放行，剩余结果无需记录
+				if b.State() == CircuitOpen {
+					t.Fatalf("第%d次请求前已打开", i+1)
+				}
+				record(t, b, failed)
+			}
+			if got := b.State(); got != tt.want {
+				t.Fatalf("状态为 %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOpenRejects(t *testing.T) {
+	b := tripped(t)
+	if b.Allow() {
+		t.Fatal("打开状态下放行了请求")
+	}
+	if retryAt := b.RetryAt(); retryAt.Before(time.Now().Add(29 * time.Second)) {
+		t.Fatalf("RetryAt() = %v, 期望在 open_duration 结束之后", retryAt)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAfterOpenDuration(t *testing.T) {
+	b := tripped(t)
+	openElapsed(b)
+	if got := b.State(); got != CircuitHalfOpen {
+		t.Fatalf("状态为 %s, 期望 %s", got, CircuitHalfOpen)
+	}
+
+	// 只放行 half_open_probes 个探测请求
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("第%d个探测请求未被放行", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("放行了超过 half_open_probes 个探测请求")
+	}
+
+	// 取消的探测请求归还名额
+	b.Cancel()
+	if !b.Allow() {
+		t.Fatal("取消后探测名额未归还")
+	}
+}
+
+func TestCircuitBreakerHalfOpenTransitions(t *testing.T) {
+	tests := []struct {
+		name   string
+		probes []bool // 依次记录的探测结果，true表示失败
+		want   string
+	}{
+		{"探测全部成功后关闭", []bool{false, false, false}, CircuitClosed},
+		{"探测部分成功保持半开", []bool{false, false}, CircuitHalfOpen},
+		{"第一个探测失败重新打开", []bool{true}, CircuitOpen},
+		{"最后一个探测失败重新打开", []bool{false, false, true}, CircuitOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tripped(t)
+			openElapsed(b)
+			record(t, b, tt.probes...)
+			if got := b.State(); got != tt.want {
+				t.Fatalf("状态为 %s, 期望 %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerReopenRestartsOpenDuration(t *testing.T) {
+	b := tripped(t)
+	openElapsed(b)
+	record(t, b, true)
+	if b.Allow() {
+		t.Fatal("探测失败重新打开后放行了请求")
+	}
+	openElapsed(b)
+	if !b.Allow() {
+		t.Fatal("重新打开 open_duration 后未进入半开状态")
+	}
+}
+
+func TestCircuitBreakerClosedStartsFreshWindow(t *testing.T) {
+	b := tripped(t)
+	openElapsed(b)
+	record(t, b, false, false, false)
+
+	// 关闭后重新统计，之前的失败不计入
+	record(t, b, true, true, false, false)
+	if got := b.State(); got != CircuitClosed {
+		t.Fatalf("状态为 %s, 期望 %s", got, CircuitClosed)
+	}
+	record(t, b, true)
+	if got := b.State(); got != CircuitOpen {
+		t.Fatalf("状态为 %s, 期望 %s", got, CircuitOpen)
+	}
+}
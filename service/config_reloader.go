@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"cdr/config"
+)
+
+// ConfigTarget 可以在运行中应用新配置的组件
+type ConfigTarget interface {
+	ApplyConfig(cfg *config.Config)
+}
+
+// ConfigReloader 监视配置文件，修改或收到SIGHUP时重新加载
+//
+// 新配置通过校验后依次交给各组件应用，校验失败时记录修改项并继续使用当前配置。
+type ConfigReloader struct {
+	path    string
+	flags   config.Overrides // 启动时的命令行参数，重新加载后仍然生效
+	current atomic.Pointer[config.Config]
+	targets []ConfigTarget
+	modTime time.Time // 最近一次加载时配置文件的修改时间
+	size    int64
+	mutex   sync.Mutex // 保证同一时间只有一次重新加载
+}
+
+// NewConfigReloader 创建配置重新加载器，cfg 为启动时从 path 和 flags 加载的配置
+func NewConfigReloader(path string, flags config.Overrides, cfg *config.Config, targets ...ConfigTarget) *ConfigReloader {
+	r := &ConfigReloader{
+		path:    path,
+		flags:   flags,
+		targets: targets,
+	}
+	r.current.Store(cfg)
+	if info, err := os.Stat(path); err == nil {
+		r.modTime, r.size = info.ModTime(), info.Size()
+	}
+	return r
+}
+
+// Current 返回当前生效的配置
+func (r *ConfigReloader) Current() *config.Config {
+	return r.current.Load()
+}
+
+// Run 按 reload.watch_interval 检查配置文件是否修改，并响应SIGHUP，直到ctx取消
+func (r *ConfigReloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// 检查间隔在启动时确定，修改后需要重启
+	var tick <-chan time.Time
+	if interval := r.Current().Reload.WatchInterval; interval > 0 {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+			if !r.modified() {
+				continue
+			}
+			log.Printf("配置文件 %s 已修改，重新加载", r.path)
+		case <-hup:
+			log.Println("收到SIGHUP，重新加载配置")
+		case <-ctx.Done():
+			return
+		}
+		r.Reload()
+	}
+}
+
+// modified 判断配置文件的修改时间或大小是否变化
+func (r *ConfigReloader) modified() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// Reload 重新加载配置文件，校验通过后应用到各组件，结果和修改项记录到日志
+func (r *ConfigReloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// 先记录文件状态，加载失败时等到文件再次修改才重试
+	if info, err := os.Stat(r.path); err == nil {
+		r.modTime, r.size = info.ModTime(), info.Size()
+	}
+
+	next, changes, err := config.Reload(r.Current(), r.path, r.flags)
+	if err == nil {
+		err = CheckConfig(next)
+	}
+	if err != nil {
+		log.Printf("配置重新加载失败，继续使用当前配置: %v", err)
+		for _, change := range changes {
+			log.Printf("  未生效的修改 %s", change)
+		}
+		return err
+	}
+
+	if len(changes) == 0 {
+		log.Println("配置没有修改")
+		return nil
+	}
+	for _, target := range r.targets {
+		target.ApplyConfig(next)
+	}
+	r.current.Store(next)
+
+	log.Printf("配置已重新加载，%d项修改", len(changes))
+	for _, change := range changes {
+		log.Printf("  %s", change)
+	}
+	return nil
+}
+
+// CheckConfig 校验配置中由服务层解释的部分：通话结局和流量曲线参数
+func CheckConfig(cfg *config.Config) error {
+	var problems []config.Problem
+	if _, err := newCallFlowSelector(cfg.Simulation.Outcomes); err != nil {
+		problems = append(problems, config.Problem{Key: "simulation.outcomes", Message: err.Error()})
+	}
+	if _, err := newRateCurve(cfg); err != nil {
+		problems = append(problems, config.Problem{Key: "load", Message: err.Error()})
+	}
+	if len(problems) > 0 {
+		return &config.ValidationError{Problems: problems}
+	}
+	return nil
+}
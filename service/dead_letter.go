@@ -0,0 +1,374 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DeadLetter 重试次数用尽后放弃的推送
+type DeadLetter struct {
+	*Delivery
+	LastError string    `json:"lastError"`
+	DeadAt    time.Time `json:"deadAt"`
+}
+
+// DeadLetterFilter 死信查询条件，零值字段不参与过滤
+type DeadLetterFilter struct {
+	ID       string
+	CallID   string
+	Account  string
+	Endpoint string    // 推送地址包含的子串
+	From     time.Time // 放弃时间不早于
+	To       time.Time // 放弃时间不晚于
+}
+
+// Match 判断死信是否满足查询条件
+func (f DeadLetterFilter) Match(dl *DeadLetter) bool {
+	if f.ID != "" && dl.ID != f.ID {
+		return false
+	}
+	if f.CallID != "" && dl.CallID != f.CallID {
+		return false
+	}
+	if f.Account != "" && dl.Account != f.Account {
+		return false
+	}
+	if f.Endpoint != "" && !strings.Contains(dl.URL, f.Endpoint) {
+		return false
+	}
+	if !f.From.IsZero() && dl.DeadAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && dl.DeadAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// DeadLetterStore 死信存储，每个推送地址一个JSON行文件
+//
+// 写入和删除死信时对目录中的锁文件加锁，运行中的推送器与死信管理工具互斥。
+type DeadLetterStore struct {
+	dir     string
+	tallies map[string]*deadLetterTally // 各死信文件的计数，供 Counts 增量统计
+	mutex   sync.Mutex
+}
+
+// deadLetterTally 一个死信文件已统计部分的计数
+//
+// 死信文件只追加；删除死信时写入新文件替换原文件，文件不再是同一个，需要重新统计。
+type deadLetterTally struct {
+	info   os.FileInfo // 上次统计时的文件信息
+	offset int64       // 已统计到的位置，之后是新追加的记录
+	counts map[pushKey]uint64
+}
+
+// NewDeadLetterStore 创建死信存储
+func NewDeadLetterStore(dir string) (*DeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建死信目录失败: %v", err)
+	}
+	return &DeadLetterStore{dir: dir, tallies: make(map[string]*deadLetterTally)}, nil
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// endpointFile 返回推送地址对应的死信文件路径
+func (s *DeadLetterStore) endpointFile(endpoint string) string {
+	name := endpoint
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		name = u.Host + u.Path
+	}
+	name = strings.Trim(unsafeFileChars.ReplaceAllString(name, "_"), "_")
+	if name == "" {
+		name = "unknown"
+	}
+	return filepath.Join(s.dir, name+".jsonl")
+}
+
+// Add 追加一条死信
+func (s *DeadLetterStore) Add(d *Delivery, lastErr error) error {
+	dl := &DeadLetter{
+		Delivery: d,
+		DeadAt:   time.Now(),
+	}
+	if lastErr != nil {
+		dl.LastError = lastErr.Error()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return appendDeadLetters(s.endpointFile(d.URL), []*DeadLetter{dl})
+}
+
+// lock 对死信目录加文件锁，返回解锁函数
+//
+// 文件锁跨进程生效，保证管理工具改写死信文件时推送器不会同时追加。
+func (s *DeadLetterStore) lock() (func(), error) {
+	file, err := os.OpenFile(filepath.Join(s.dir, ".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开死信目录锁文件失败: %v", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("锁定死信目录失败: %v", err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// appendDeadLetters 以JSON行格式追加死信
+func appendDeadLetters(path string, letters []*DeadLetter) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开死信文件失败: %v", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, dl := range letters {
+		data, err := json.Marshal(dl)
+		if err != nil {
+			return fmt.Errorf("JSON序列化失败: %v", err)
+		}
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("写入死信文件失败: %v", err)
+	}
+	return nil
+}
+
+// readDeadLetters 读取死信文件中的所有记录
+func readDeadLetters(path string) ([]*DeadLetter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开死信文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var letters []*DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var dl DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &dl); err != nil || dl.Delivery == nil {
+			continue
+		}
+		letters = append(letters, &dl)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取死信文件失败: %v", err)
+	}
+	return letters, nil
+}
+
+// files 返回所有死信文件
+func (s *DeadLetterStore) files() ([]string, error) {
+	return filepath.Glob(filepath.Join(s.dir, "*.jsonl"))
+}
+
+// List 返回满足条件的死信，按放弃时间排序
+func (s *DeadLetterStore) List(filter DeadLetterFilter) ([]*DeadLetter, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*DeadLetter
+	for _, path := range files {
+		letters, err := readDeadLetters(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, dl := range letters {
+			if filter.Match(dl) {
+				result = append(result, dl)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeadAt.Before(result[j].DeadAt)
+	})
+	return result, nil
+}
+
+// Remove 删除满足条件的死信，返回删除的数量
+func (s *DeadLetterStore) Remove(filter DeadLetterFilter) (int, error) {
+	return s.remove(filter.Match)
+}
+
+// RemoveLetters 删除指定的死信，返回删除的数量，之后新写入的死信即使满足相同条件也不受影响
+func (s *DeadLetterStore) RemoveLetters(letters []*DeadLetter) (int, error) {
+	ids := make(map[string]bool, len(letters))
+	for _, dl := range letters {
+		ids[dl.ID] = true
+	}
+	return s.remove(func(dl *DeadLetter) bool { return ids[dl.ID] })
+}
+
+// remove 删除 match 返回true的死信
+//
+// 持有目录锁期间读取并改写文件，保留的记录先写入临时文件再替换原文件，
+// 推送器在此期间等待锁，之后追加到替换后的文件中，不会丢失。
+func (s *DeadLetterStore) remove(match func(dl *DeadLetter) bool) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	unlock, err := s.lock()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range files {
+		letters, err := readDeadLetters(path)
+		if err != nil {
+			return removed, err
+		}
+
+		var kept []*DeadLetter
+		for _, dl := range letters {
+			if !match(dl) {
+				kept = append(kept, dl)
+			}
+		}
+		if len(kept) == len(letters) {
+			continue
+		}
+
+		if len(kept) == 0 {
+			if err := os.Remove(path); err != nil {
+				return removed, fmt.Errorf("删除死信文件失败: %v", err)
+			}
+		} else if err := replaceDeadLetters(path, kept); err != nil {
+			return removed, err
+		}
+		removed += len(letters) - len(kept)
+	}
+	return removed, nil
+}
+
+// replaceDeadLetters 用 letters 替换死信文件的内容，先写临时文件再改名，中途失败时原文件不变
+func replaceDeadLetters(path string, letters []*DeadLetter) error {
+	tmpPath := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	os.Remove(tmpPath)
+	if err := appendDeadLetters(tmpPath, letters); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("替换死信文件失败: %v", err)
+	}
+	return nil
+}
+
+// Counts 按推送类型、账号和推送地址统计死信数量
+//
+// 只读取上次统计之后追加的记录，被管理工具改写过的文件重新统计。
+// 某个文件读取失败时返回其他文件的计数和遇到的错误。
+func (s *DeadLetterStore) Counts() (map[pushKey]uint64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[pushKey]uint64)
+	seen := make(map[string]bool, len(files))
+	var firstErr error
+	for _, path := range files {
+		seen[path] = true
+		tally, err := s.tally(path)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		for key, n := range tally.counts {
+			counts[key] += n
+		}
+	}
+	for path := range s.tallies {
+		if !seen[path] {
+			delete(s.tallies, path)
+		}
+	}
+	return counts, firstErr
+}
+
+// tally 更新一个死信文件的计数
+func (s *DeadLetterStore) tally(path string) (*deadLetterTally, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开死信文件失败: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("读取死信文件信息失败: %v", err)
+	}
+
+	tally := s.tallies[path]
+	if tally == nil || !os.SameFile(tally.info, info) || info.Size() < tally.offset {
+		tally = &deadLetterTally{counts: make(map[pushKey]uint64)}
+	}
+	tally.info = info
+	s.tallies[path] = tally
+	if info.Size() == tally.offset {
+		return tally, nil
+	}
+	if _, err := file.Seek(tally.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("读取死信文件失败: %v", err)
+	}
+
+	// 只统计完整的行，正在写入的最后一行留到下次统计
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return tally, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取死信文件失败: %v", err)
+		}
+		tally.offset += int64(len(line))
+
+		var dl DeadLetter
+		if json.Unmarshal(line, &dl) != nil || dl.Delivery == nil {
+			continue
+		}
+		tally.counts[pushKey{dl.Kind, dl.Account, dl.URL}]++
+	}
+}
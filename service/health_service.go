@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"cdr/config"
@@ -11,8 +12,10 @@ import (
 
 // HealthService 提供系统健康检查功能
 type HealthService struct {
-	config          *config.Config
-	callStatusSvc   *CallStatusService
+	config          atomic.Pointer[config.Config]
+	callStatusSvc   *CallStatusService // CDR推送进程中为nil
+	cdrSvc          *CDRService
+	pusher          *Pusher
 	lastCheckTime   time.Time
 	lastCheckResult *HealthStatus
 	mux             sync.RWMutex
@@ -25,20 +28,36 @@ type HealthStatus struct {
 	ConfigStatus     string    `json:"configStatus"`      // 配置状态
 	CallServiceState string    `json:"callServiceState"`  // 呼叫服务状态
 	Details          string    `json:"details,omitempty"` // 详细信息（如果有错误）
+
+	TargetRate float64           `json:"targetRate"`         // 当前新建呼叫或生成CDR的目标速率（每秒），0表示不限速
+	Circuits   map[string]string `json:"circuits,omitempty"` // 各推送地址的熔断器状态
+
+	Liveness  *ProbeStatus `json:"liveness"`  // 存活检查结果，同 /livez
+	Readiness *ProbeStatus `json:"readiness"` // 就绪检查结果，同 /readyz
 }
 
-// NewHealthService 创建健康检查服务实例
-func NewHealthService(cfg *config.Config, callStatusSvc *CallStatusService) *HealthService {
-	return &HealthService{
-		config:        cfg,
+// NewHealthService 创建健康检查服务实例，CDR推送进程没有呼叫状态服务，callStatusSvc 传nil
+func NewHealthService(cfg *config.Config, callStatusSvc *CallStatusService, cdrSvc *CDRService, pusher *Pusher) *HealthService {
+	h := &HealthService{
 		callStatusSvc: callStatusSvc,
+		cdrSvc:        cdrSvc,
+		pusher:        pusher,
 	}
+	h.config.Store(cfg)
+	return h
+}
+
+// ApplyConfig 应用重新加载的配置，之后的检查使用新的阈值
+func (h *HealthService) ApplyConfig(cfg *config.Config) {
+	h.config.Store(cfg)
 }
 
-// StartHealthServer 启动健康检查HTTP服务
-func (h *HealthService) StartHealthServer(port string) error {
-	http.HandleFunc("/health", h.handleHealthCheck)
-	return http.ListenAndServe(":"+port, nil)
+// RegisterHandlers 在管理服务上注册健康检查和指标接口
+func (h *HealthService) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/health", h.handleHealthCheck)
+	mux.HandleFunc("/livez", h.handleLiveness)
+	mux.HandleFunc("/readyz", h.handleReadiness)
+	mux.HandleFunc("/metrics", h.handleMetrics)
 }
 
 // handleHealthCheck 处理健康检查HTTP请求
@@ -60,6 +79,24 @@ func (h *HealthService) handleHealthCheck(w http.ResponseWriter, r *http.Request
 	h.writeResponse(w, status)
 }
 
+// handleMetrics 以Prometheus文本格式输出指标
+func (h *HealthService) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := NewMetricWriter(w)
+
+	if h.callStatusSvc != nil {
+		mw.Gauge("cdrpush_active_calls", "进行中的通话数", float64(h.callStatusSvc.ActiveCalls()))
+		mw.Gauge("cdrpush_target_rate", "流量曲线当前的目标速率（每秒），0表示不限速",
+			h.callStatusSvc.Load().TargetRate(), "source", "new_call")
+	} else if h.cdrSvc != nil {
+		mw.Gauge("cdrpush_target_rate", "流量曲线当前的目标速率（每秒），0表示不限速",
+			h.cdrSvc.Load().TargetRate(), "source", "cdr")
+	}
+	if h.pusher != nil {
+		h.pusher.WriteMetrics(mw)
+	}
+}
+
 // checkHealth 执行健康检查
 func (h *HealthService) checkHealth() *HealthStatus {
 	status := &HealthStatus{
@@ -67,23 +104,40 @@ func (h *HealthService) checkHealth() *HealthStatus {
 	}
 
 	// 检查配置状态
-	if h.config == nil {
+	if h.config.Load() == nil {
 		status.ConfigStatus = "unhealthy"
 		status.Details = "配置未加载"
 	} else {
 		status.ConfigStatus = "healthy"
 	}
 
-	// 检查呼叫服务状态
-	if h.callStatusSvc == nil {
+	// 检查呼叫服务状态，CDR推送进程只检查CDR服务
+	switch {
+	case h.callStatusSvc != nil:
+		status.CallServiceState = "healthy"
+		status.TargetRate = h.callStatusSvc.Load().TargetRate()
+	case h.cdrSvc != nil:
+		status.CallServiceState = "healthy"
+		status.TargetRate = h.cdrSvc.Load().TargetRate()
+	default:
 		status.CallServiceState = "unhealthy"
 		status.Details = "呼叫服务未初始化"
-	} else {
-		status.CallServiceState = "healthy"
+	}
+
+	// 熔断器状态，熔断打开时推送会进入重试队列，不影响整体状态
+	if h.pusher != nil {
+		status.Circuits = h.pusher.CircuitStates()
+	}
+
+	// 存活与就绪检查，任一组件不健康时整体不健康
+	if h.config.Load() != nil {
+		status.Liveness = h.checkLiveness()
+		status.Readiness = h.checkReadiness()
 	}
 
 	// 设置整体状态
-	if status.ConfigStatus == "healthy" && status.CallServiceState == "healthy" {
+	if status.ConfigStatus == "healthy" && status.CallServiceState == "healthy" &&
+		status.Liveness.Status == "healthy" && status.Readiness.Status == "healthy" {
 		status.Status = "healthy"
 	} else {
 		status.Status = "unhealthy"
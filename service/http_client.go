@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"cdr/config"
+)
+
+// tlsVersions 配置中的TLS版本名称
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewHTTPClient 根据 push.http 配置创建推送使用的HTTP客户端
+//
+// 读取超时按推送地址在每个请求上单独设置，见 Pusher.timeout。
+func NewHTTPClient(cfg *config.Config) (*http.Client, error) {
+	httpCfg := cfg.Push.HTTP
+
+	tlsConfig := &tls.Config{}
+	if httpCfg.TLSMinVersion != "" {
+		version, ok := tlsVersions[httpCfg.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf("不支持的TLS版本: %s", httpCfg.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	// 自定义CA证书
+	if httpCfg.CAFile != "" {
+		pem, err := os.ReadFile(httpCfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", httpCfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// 双向TLS客户端证书
+	if httpCfg.CertFile != "" || httpCfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(httpCfg.CertFile, httpCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(httpCfg.ConnectTimeout) * time.Second,
+		KeepAlive: time.Duration(httpCfg.KeepAlive) * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: time.Duration(httpCfg.ConnectTimeout) * time.Second,
+		MaxIdleConnsPerHost: httpCfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+		ForceAttemptHTTP2:   true,
+	}
+	if httpCfg.KeepAlive < 0 {
+		transport.DisableKeepAlives = true
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
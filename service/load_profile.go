@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"cdr/config"
+)
+
+// 流量曲线类型
+const (
+	LoadProfileRamp    = "ramp"    // 线性爬坡
+	LoadProfileStep    = "step"    // 分阶段恒定速率
+	LoadProfileSpike   = "spike"   // 基础速率上周期性突增
+	LoadProfileDiurnal = "diurnal" // 24小时曲线压缩到N分钟
+)
+
+// defaultHourly 未配置 load.diurnal.hourly 时使用的24小时话务曲线（相对最高峰的比例）
+var defaultHourly = []float64{
+	0.10, 0.06, 0.04, 0.03, 0.03, 0.05, 0.12, 0.30, 0.60, 0.85, 1.00, 0.95,
+	0.75, 0.70, 0.85, 0.95, 0.90, 0.80, 0.65, 0.55, 0.50, 0.40, 0.28, 0.16,
+}
+
+// LoadShaper 按流量曲线调整速率限制，驱动新建呼叫或CDR生成的节奏
+//
+// 未配置流量曲线时按 base 恒定速率，base为0时不限速。运行中可以暂停，
+// 也可以通过 SetRate 以固定速率替换流量曲线。
+//
+// 流量曲线从第一次 Wait 开始计时，未使用的流量控制器不占用协程，Close 后停止跟随流量曲线。
+type LoadShaper struct {
+	rateAt   func(elapsed time.Duration) float64 // 为nil时恒定速率，取值总是大于0
+	limiter  *RateLimiter                        // 不限速时为nil
+	burst    int
+	start    time.Time
+	target   float64
+	paused   bool
+	override bool // 已通过 SetRate 设置固定速率，不再跟随流量曲线
+	mutex    sync.RWMutex
+	started  sync.Once
+	stop     chan struct{} // Close 时关闭
+	stopped  sync.Once
+}
+
+// NewLoadShaper 根据 load 配置创建流量控制器，base 为未配置流量曲线时的恒定速率
+func NewLoadShaper(cfg *config.Config, base float64) (*LoadShaper, error) {
+	rateAt, err := newRateCurve(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &LoadShaper{
+		rateAt: rateAt,
+		burst:  cfg.Rate.Burst,
+		target: base,
+		stop:   make(chan struct{}),
+	}
+	if rateAt == nil {
+		s.limiter = NewRateLimiter(base, cfg.Rate.Burst)
+		return s, nil
+	}
+
+	s.target = rateAt(0)
+	s.limiter = NewRateLimiter(s.target, cfg.Rate.Burst)
+	return s, nil
+}
+
+// Close 停止跟随流量曲线，之后的目标速率保持不变
+func (s *LoadShaper) Close() {
+	s.stopped.Do(func() { close(s.stop) })
+}
+
+// begin 第一次放行时开始按流量曲线计时
+func (s *LoadShaper) begin() {
+	s.started.Do(func() {
+		if s.rateAt == nil {
+			return
+		}
+		s.mutex.Lock()
+		s.start = time.Now()
+		s.mutex.Unlock()
+		go s.run()
+	})
+}
+
+// run 每200毫秒按流量曲线更新一次目标速率，直到 Close 或通过 SetRate 设置了固定速率
+func (s *LoadShaper) run() {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+		rate := s.rateAt(time.Since(s.start))
+		s.mutex.Lock()
+		if s.override {
+			s.mutex.Unlock()
+			return
+		}
+		s.target = rate
+		s.limiter.SetRate(rate)
+		s.mutex.Unlock()
+	}
+}
+
+// Wait 等待下一次放行，暂停期间一直阻塞，ctx取消时返回其错误
+func (s *LoadShaper) Wait(ctx context.Context) error {
+	s.begin()
+	for {
+		s.mutex.RLock()
+		paused, limiter := s.paused, s.limiter
+		s.mutex.RUnlock()
+		if !paused {
+			return limiter.Wait(ctx)
+		}
+		if err := sleepContext(ctx, 100*time.Millisecond); err != nil {
+			return err
+		}
+	}
+}
+
+// SetRate 以固定速率替换流量曲线，rate为0时不限速
+func (s *LoadShaper) SetRate(rate float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.override = true
+	s.target = rate
+	switch {
+	case rate <= 0:
+		s.limiter = nil
+	case s.limiter == nil:
+		s.limiter = NewRateLimiter(rate, s.burst)
+	default:
+		s.limiter.SetRate(rate)
+	}
+}
+
+// SetBase 修改未配置流量曲线时的恒定速率，rate为0时不限速；配置了流量曲线时不生效
+func (s *LoadShaper) SetBase(rate float64) {
+	if s.rateAt != nil {
+		return
+	}
+	s.SetRate(rate)
+}
+
+// SetPaused 暂停或恢复放行
+func (s *LoadShaper) SetPaused(paused bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.paused = paused
+}
+
+// Paused 返回是否已暂停
+func (s *LoadShaper) Paused() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.paused
+}
+
+// TargetRate 返回当前的目标速率（每秒），为0且未配置流量曲线时表示不限速
+func (s *LoadShaper) TargetRate() float64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.target
+}
+
+// newRateCurve 根据 load.profile 创建速率曲线，未配置时返回nil
+//
+// 速率为0在其他配置中表示不限速，流量曲线的各个取值都必须大于0，需要暂停时使用管理接口。
+func newRateCurve(cfg *config.Config) (func(elapsed time.Duration) float64, error) {
+	load := cfg.Load
+	switch load.Profile {
+	case "":
+		return nil, nil
+
+	case LoadProfileRamp:
+		ramp := load.Ramp
+		if ramp.Duration <= 0 {
+			return nil, fmt.Errorf("ramp流量曲线的duration必须大于0")
+		}
+		if ramp.From <= 0 || ramp.To <= 0 {
+			return nil, fmt.Errorf("ramp流量曲线的from和to必须大于0")
+		}
+		duration := time.Duration(ramp.Duration) * time.Second
+		return func(elapsed time.Duration) float64 {
+			if elapsed >= duration {
+				return ramp.To
+			}
+			return ramp.From + (ramp.To-ramp.From)*elapsed.Seconds()/duration.Seconds()
+		}, nil
+
+	case LoadProfileStep:
+		if len(load.Steps) == 0 {
+			return nil, fmt.Errorf("step流量曲线至少需要一个阶段")
+		}
+		var total time.Duration
+		for i, step := range load.Steps {
+			if step.Duration <= 0 {
+				return nil, fmt.Errorf("step流量曲线第%d个阶段的duration必须大于0", i+1)
+			}
+			if step.Rate <= 0 {
+				return nil, fmt.Errorf("step流量曲线第%d个阶段的rate必须大于0", i+1)
+			}
+			total += time.Duration(step.Duration) * time.Second
+		}
+		steps := load.Steps
+		repeat := load.Repeat
+		return func(elapsed time.Duration) float64 {
+			if repeat {
+				elapsed %= total
+			}
+			for _, step := range steps {
+				elapsed -= time.Duration(step.Duration) * time.Second
+				if elapsed < 0 {
+					return step.Rate
+				}
+			}
+			// 全部阶段结束后保持最后一个阶段的速率
+			return steps[len(steps)-1].Rate
+		}, nil
+
+	case LoadProfileSpike:
+		spike := load.Spike
+		if spike.Interval <= 0 || spike.Duration <= 0 || spike.Duration > spike.Interval {
+			return nil, fmt.Errorf("spike流量曲线的interval和duration必须大于0，且duration不能超过interval")
+		}
+		if spike.Base <= 0 || spike.Peak <= 0 {
+			return nil, fmt.Errorf("spike流量曲线的base和peak必须大于0")
+		}
+		interval := time.Duration(spike.Interval) * time.Second
+		duration := time.Duration(spike.Duration) * time.Second
+		return func(elapsed time.Duration) float64 {
+			// 每个周期的末尾突增到峰值速率
+			if elapsed%interval >= interval-duration {
+				return spike.Peak
+			}
+			return spike.Base
+		}, nil
+
+	case LoadProfileDiurnal:
+		diurnal := load.Diurnal
+		if diurnal.Minutes <= 0 {
+			return nil, fmt.Errorf("diurnal流量曲线的minutes必须大于0")
+		}
+		if diurnal.Min <= 0 || diurnal.Max < diurnal.Min {
+			return nil, fmt.Errorf("diurnal流量曲线的min必须大于0，且max不能小于min")
+		}
+		hourly := diurnal.Hourly
+		if len(hourly) == 0 {
+			hourly = defaultHourly
+		}
+		if len(hourly) != 24 {
+			return nil, fmt.Errorf("diurnal流量曲线的hourly需要24个值，实际为%d个", len(hourly))
+		}
+		for i, weight := range hourly {
+			if weight < 0 || weight > 1 {
+				return nil, fmt.Errorf("diurnal流量曲线的hourly必须在0到1之间，第%d个为%v", i+1, weight)
+			}
+		}
+		day := time.Duration(diurnal.Minutes) * time.Minute
+		return func(elapsed time.Duration) float64 {
+			// 将经过的时间换算为一天中的小时，相邻两个整点之间线性插值
+			hour := float64(elapsed%day) / float64(day) * 24
+			i := int(hour)
+			frac := hour - math.Floor(hour)
+			weight := hourly[i] + (hourly[(i+1)%24]-hourly[i])*frac
+			return diurnal.Min + (diurnal.Max-diurnal.Min)*weight
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的流量曲线: %s", load.Profile)
+}
@@ -5,21 +5,28 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
 // Logger 处理日志记录的结构体
+//
+// 推送日志由各工作协程并发写入，写入和轮转都在锁内进行。
 type Logger struct {
 	logDir      string
 	statusFile  *os.File // 状态推送日志文件
 	cdrFile     *os.File // CDR推送日志文件
 	maxFileSize int64
+	mutex       sync.Mutex
 }
 
+// LogDir 推送日志目录
+const LogDir = "logs"
+
 // NewLogger 创建日志记录器实例
 func NewLogger(logTypes ...string) (*Logger, error) {
 	// 创建logs目录
-	logDir := "logs"
+	logDir := LogDir
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("创建日志目录失败: %v", err)
 	}
@@ -40,7 +47,7 @@ func NewLogger(logTypes ...string) (*Logger, error) {
 	return logger, nil
 }
 
-// rotateLogFile 创建或轮转日志文件
+// rotateLogFile 创建或轮转日志文件，调用方需持有锁或在创建时调用
 func (l *Logger) rotateLogFile(fileType string) error {
 	// 生成新的日志文件名
 	timestamp := time.Now().Format("20060102150405")
@@ -74,19 +81,11 @@ func (l *Logger) rotateLogFile(fileType string) error {
 }
 
 // LogPushStatus 记录推送状态的日志
-func (l *Logger) LogPushStatus(callID string, url string, requestData []byte, statusCode int, responseErr error) {
-	// 检查文件大小是否需要轮转
-	if info, err := l.statusFile.Stat(); err == nil && info.Size() > l.maxFileSize {
-		if err := l.rotateLogFile("status"); err != nil {
-			log.Printf("轮转状态日志文件失败: %v", err)
-			return
-		}
-	}
-
+func (l *Logger) LogPushStatus(account string, callID string, url string, requestData []byte, statusCode int, responseErr error) {
 	// 格式化日志内容
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logContent := fmt.Sprintf("[%s] CallID: %s\nURL: %s\nRequest: %s\nStatusCode: %d\n",
-		timestamp, callID, url, string(requestData), statusCode)
+	logContent := fmt.Sprintf("[%s] Account: %s, CallID: %s\nURL: %s\nRequest: %s\nStatusCode: %d\n",
+		timestamp, account, callID, url, string(requestData), statusCode)
 
 	// 如果有错误，添加错误信息
 	if responseErr != nil {
@@ -95,6 +94,17 @@ func (l *Logger) LogPushStatus(callID string, url string, requestData []byte, st
 
 	logContent += "----------------------------------------\n"
 
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// 检查文件大小是否需要轮转
+	if info, err := l.statusFile.Stat(); err == nil && info.Size() > l.maxFileSize {
+		if err := l.rotateLogFile("status"); err != nil {
+			log.Printf("轮转状态日志文件失败: %v", err)
+			return
+		}
+	}
+
 	// 写入日志文件
 	if _, err := l.statusFile.WriteString(logContent); err != nil {
 		log.Printf("写入状态日志失败: %v", err)
@@ -102,19 +112,11 @@ func (l *Logger) LogPushStatus(callID string, url string, requestData []byte, st
 }
 
 // LogPushCDR 记录CDR推送的日志
-func (l *Logger) LogPushCDR(callID string, url string, requestData []byte, statusCode int, responseErr error) {
-	// 检查文件大小是否需要轮转
-	if info, err := l.cdrFile.Stat(); err == nil && info.Size() > l.maxFileSize {
-		if err := l.rotateLogFile("cdr"); err != nil {
-			log.Printf("轮转CDR日志文件失败: %v", err)
-			return
-		}
-	}
-
+func (l *Logger) LogPushCDR(account string, callID string, url string, requestData []byte, statusCode int, responseErr error) {
 	// 格式化日志内容
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	logContent := fmt.Sprintf("[%s] CallID: %s\nURL: %s\nRequest: %s\nStatusCode: %d\n",
-		timestamp, callID, url, string(requestData), statusCode)
+	logContent := fmt.Sprintf("[%s] Account: %s, CallID: %s\nURL: %s\nRequest: %s\nStatusCode: %d\n",
+		timestamp, account, callID, url, string(requestData), statusCode)
 
 	// 如果有错误，添加错误信息
 	if responseErr != nil {
@@ -123,6 +125,17 @@ func (l *Logger) LogPushCDR(callID string, url string, requestData []byte, statu
 
 	logContent += "----------------------------------------\n"
 
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// 检查文件大小是否需要轮转
+	if info, err := l.cdrFile.Stat(); err == nil && info.Size() > l.maxFileSize {
+		if err := l.rotateLogFile("cdr"); err != nil {
+			log.Printf("轮转CDR日志文件失败: %v", err)
+			return
+		}
+	}
+
 	// 写入日志文件
 	if _, err := l.cdrFile.WriteString(logContent); err != nil {
 		log.Printf("写入CDR日志失败: %v", err)
@@ -131,6 +144,9 @@ func (l *Logger) LogPushCDR(callID string, url string, requestData []byte, statu
 
 // Close 关闭日志文件
 func (l *Logger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
 	// 关闭状态推送日志文件
 	if l.statusFile != nil {
 		if err := l.statusFile.Close(); err != nil {
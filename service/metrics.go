@@ -0,0 +1,256 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets HTTP请求耗时直方图的桶上限（秒）
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// pushKey 按推送类型、账号和推送地址区分的统计项
+type pushKey struct {
+	kind     string
+	account  string
+	endpoint string
+}
+
+// labels 返回统计项的标签，后面可以追加其他标签
+func (k pushKey) labels(extra ...string) []string {
+	return append([]string{"type", k.kind, "account", k.account, "endpoint", k.endpoint}, extra...)
+}
+
+// retryKey 按推送类型、账号和第几次尝试区分的重试统计项
+type retryKey struct {
+	kind    string
+	account string
+	attempt int
+}
+
+// histogram 累计直方图，counts[i]为耗时不超过latencyBuckets[i]的请求数
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// PushMetrics 推送统计指标
+type PushMetrics struct {
+	attempts    map[pushKey]uint64
+	successes   map[pushKey]uint64
+	failures    map[pushKey]uint64
+	deadLetters map[pushKey]uint64
+	retries     map[retryKey]uint64
+	latency     map[pushKey]*histogram
+	mutex       sync.Mutex
+}
+
+// NewPushMetrics 创建推送统计指标
+func NewPushMetrics() *PushMetrics {
+	return &PushMetrics{
+		attempts:    make(map[pushKey]uint64),
+		successes:   make(map[pushKey]uint64),
+		failures:    make(map[pushKey]uint64),
+		deadLetters: make(map[pushKey]uint64),
+		retries:     make(map[retryKey]uint64),
+		latency:     make(map[pushKey]*histogram),
+	}
+}
+
+// recordAttempt 记录一次投递尝试，attempt 为已尝试次数，大于0时同时计为重试
+func (m *PushMetrics) recordAttempt(kind, account, endpoint string, attempt int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.attempts[pushKey{kind, account, endpoint}]++
+	if attempt > 0 {
+		m.retries[retryKey{kind, account, attempt + 1}]++
+	}
+}
+
+// recordResult 记录一次投递尝试的结果
+func (m *PushMetrics) recordResult(kind, account, endpoint string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err == nil {
+		m.successes[pushKey{kind, account, endpoint}]++
+	} else {
+		m.failures[pushKey{kind, account, endpoint}]++
+	}
+}
+
+// recordDeadLetter 记录一条转入死信的推送
+func (m *PushMetrics) recordDeadLetter(kind, account, endpoint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.deadLetters[pushKey{kind, account, endpoint}]++
+}
+
+// observeLatency 记录一次HTTP请求的耗时
+func (m *PushMetrics) observeLatency(kind, account, endpoint string, elapsed time.Duration) {
+	seconds := elapsed.Seconds()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	h, ok := m.latency[pushKey{kind, account, endpoint}]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latency[pushKey{kind, account, endpoint}] = h
+	}
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+// totals 返回投递成功和转入死信的总数
+func (m *PushMetrics) totals() (succeeded, deadLetters uint64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, n := range m.successes {
+		succeeded += n
+	}
+	for _, n := range m.deadLetters {
+		deadLetters += n
+	}
+	return succeeded, deadLetters
+}
+
+// write 以Prometheus文本格式输出推送统计指标
+func (m *PushMetrics) write(w *MetricWriter) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writeCounters := func(name, help string, values map[pushKey]uint64) {
+		w.Header(name, help, "counter")
+		for _, key := range sortedPushKeys(values) {
+			w.Sample(name, float64(values[key]), key.labels()...)
+		}
+	}
+	writeCounters("cdrpush_push_attempts_total", "推送尝试次数", m.attempts)
+	writeCounters("cdrpush_push_succeeded_total", "推送成功次数", m.successes)
+	writeCounters("cdrpush_push_failed_total", "推送失败次数", m.failures)
+	writeCounters("cdrpush_dead_letters_total", "本进程转入死信的推送数", m.deadLetters)
+
+	w.Header("cdrpush_push_retries_total", "按第几次尝试统计的重试次数", "counter")
+	retryKeys := make([]retryKey, 0, len(m.retries))
+	for key := range m.retries {
+		retryKeys = append(retryKeys, key)
+	}
+	sort.Slice(retryKeys, func(i, j int) bool {
+		if retryKeys[i].kind != retryKeys[j].kind {
+			return retryKeys[i].kind < retryKeys[j].kind
+		}
+		if retryKeys[i].account != retryKeys[j].account {
+			return retryKeys[i].account < retryKeys[j].account
+		}
+		return retryKeys[i].attempt < retryKeys[j].attempt
+	})
+	for _, key := range retryKeys {
+		w.Sample("cdrpush_push_retries_total", float64(m.retries[key]), "type", key.kind, "account", key.account, "attempt", strconv.Itoa(key.attempt))
+	}
+
+	name := "cdrpush_http_request_duration_seconds"
+	w.Header(name, "推送HTTP请求耗时", "histogram")
+	latencyKeys := make([]pushKey, 0, len(m.latency))
+	for key := range m.latency {
+		latencyKeys = append(latencyKeys, key)
+	}
+	sortPushKeys(latencyKeys)
+	for _, key := range latencyKeys {
+		h := m.latency[key]
+		for i, bound := range latencyBuckets {
+			w.Sample(name+"_bucket", float64(h.counts[i]), key.labels("le", formatFloat(bound))...)
+		}
+		w.Sample(name+"_bucket", float64(h.count), key.labels("le", "+Inf")...)
+		w.Sample(name+"_sum", h.sum, key.labels()...)
+		w.Sample(name+"_count", float64(h.count), key.labels()...)
+	}
+}
+
+// sortedPushKeys 返回按类型、账号和推送地址排序的统计项
+func sortedPushKeys(values map[pushKey]uint64) []pushKey {
+	keys := make([]pushKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sortPushKeys(keys)
+	return keys
+}
+
+func sortPushKeys(keys []pushKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		if keys[i].account != keys[j].account {
+			return keys[i].account < keys[j].account
+		}
+		return keys[i].endpoint < keys[j].endpoint
+	})
+}
+
+// labelEscaper 转义Prometheus标签值中的特殊字符
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricWriter 输出Prometheus文本格式（0.0.4）的指标
+type MetricWriter struct {
+	w   io.Writer
+	err error
+}
+
+// NewMetricWriter 创建指标输出器
+func NewMetricWriter(w io.Writer) *MetricWriter {
+	return &MetricWriter{w: w}
+}
+
+// Header 输出指标的说明和类型
+func (m *MetricWriter) Header(name, help, metricType string) {
+	m.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// Sample 输出一个样本，labels 为交替的标签名和标签值
+func (m *MetricWriter) Sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(&b, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	m.printf("%s %s\n", b.String(), formatFloat(value))
+}
+
+// Gauge 输出只有一个样本的仪表盘指标
+func (m *MetricWriter) Gauge(name, help string, value float64, labels ...string) {
+	m.Header(name, help, "gauge")
+	m.Sample(name, value, labels...)
+}
+
+// Err 返回输出过程中的第一个错误
+func (m *MetricWriter) Err() error {
+	return m.err
+}
+
+func (m *MetricWriter) printf(format string, args ...any) {
+	if m.err != nil {
+		return
+	}
+	_, m.err = fmt.Fprintf(m.w, format, args...)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"cdr/config"
+	"cdr/models"
+)
+
+// 隐私号绑定模式
+const (
+	BindingModeAXB = "AXB" // A与B通过X互相呼叫
+	BindingModeAX  = "AX"  // 任意号码呼叫X转接到A
+)
+
+// NumberBinding X号码的绑定关系
+type NumberBinding struct {
+	Mode         string
+	NumberPoolNo string
+	PhoneNoX     string
+	PhoneNoA     string
+	PhoneNoB     string // AX模式下为空
+	ExpireAt     time.Time
+}
+
+// PrivacyRoute 一次隐私号呼叫的路由结果
+type PrivacyRoute struct {
+	Binding        NumberBinding
+	Caller         string
+	Callee         string
+	SecretCallType int
+	Expired        bool // 呼叫时绑定已过期
+}
+
+// NumberPool 隐私号号码池，维护X号码与A/B号码的绑定关系
+type NumberPool struct {
+	poolNo      string
+	bindings    []*NumberBinding
+	axRatio     int
+	ttl         time.Duration
+	rebindDelay time.Duration
+	generate    func() string // 生成A/B号码
+	mutex       sync.Mutex
+}
+
+// NewNumberPool 创建号码池并为每个X号码建立初始绑定
+func NewNumberPool(cfg *config.Config, generate func() string) *NumberPool {
+	pool := &NumberPool{
+		poolNo:      cfg.Privacy.NumberPoolNo,
+		bindings:    make([]*NumberBinding, cfg.Privacy.XNumbers),
+		axRatio:     cfg.Privacy.AXRatio,
+		ttl:         time.Duration(cfg.Privacy.BindingTTL) * time.Second,
+		rebindDelay: time.Duration(cfg.Privacy.RebindDelay) * time.Second,
+		generate:    generate,
+	}
+
+	now := time.Now()
+	for i := range pool.bindings {
+		pool.bindings[i] = &NumberBinding{
+			NumberPoolNo: pool.poolNo,
+			PhoneNoX:     fmt.Sprintf("170%08d", i),
+		}
+		pool.bind(pool.bindings[i], now)
+		// 错开初始过期时间，避免所有绑定同时过期
+		pool.bindings[i].ExpireAt = now.Add(time.Duration(rand.Int63n(int64(pool.ttl))) + time.Second)
+	}
+	return pool
+}
+
+// bind 为X号码建立新的绑定关系
+func (p *NumberPool) bind(b *NumberBinding, now time.Time) {
+	b.PhoneNoA = p.generate()
+	b.PhoneNoB = ""
+	b.Mode = BindingModeAX
+	if rand.Intn(100) >= p.axRatio {
+		b.Mode = BindingModeAXB
+		b.PhoneNoB = p.generate()
+	}
+	b.ExpireAt = now.Add(p.ttl)
+}
+
+// Route 随机选择一个X号码并按其绑定关系确定主被叫
+//
+// 绑定过期后在rebind_delay内保持未绑定状态，期间的呼叫被叫为X号码本身且标记为过期。
+func (p *NumberPool) Route(now time.Time) *PrivacyRoute {
+	p.mutex.Lock()
+	b := p.bindings[rand.Intn(len(p.bindings))]
+	if now.After(b.ExpireAt.Add(p.rebindDelay)) {
+		p.bind(b, now)
+	}
+	route := &PrivacyRoute{
+		Binding: *b,
+		Expired: now.After(b.ExpireAt),
+	}
+	p.mutex.Unlock()
+
+	switch {
+	case route.Binding.Mode == BindingModeAX:
+		// AX模式下任意号码呼叫X转接到A，主叫记为B
+		route.Binding.PhoneNoB = p.generate()
+		route.Caller = route.Binding.PhoneNoB
+		route.Callee = route.Binding.PhoneNoA
+		route.SecretCallType = models.SecretCallTypeBToA
+	case rand.Intn(2) == 0:
+		route.Caller = route.Binding.PhoneNoA
+		route.Callee = route.Binding.PhoneNoB
+		route.SecretCallType = models.SecretCallTypeAToB
+	default:
+		route.Caller = route.Binding.PhoneNoB
+		route.Callee = route.Binding.PhoneNoA
+		route.SecretCallType = models.SecretCallTypeBToA
+	}
+
+	// 绑定已过期时无法转接，被叫为拨打的X号码
+	if route.Expired {
+		route.Callee = route.Binding.PhoneNoX
+	}
+	return route
+}
+
+// applyToStatus 填充状态推送中的隐私号字段，与同一呼叫的话单一致
+func (r *PrivacyRoute) applyToStatus(status *models.CallStatus) {
+	status.Caller = r.Caller
+	status.Callee = r.Callee
+	status.NumberPoolNo = r.Binding.NumberPoolNo
+	status.PhoneNoX = r.Binding.PhoneNoX
+	status.PhoneNoA = r.Binding.PhoneNoA
+	status.PhoneNoB = r.Binding.PhoneNoB
+	status.SecretCallType = r.SecretCallType
+}
+
+// applyToCDR 填充话单中的隐私号字段
+func (r *PrivacyRoute) applyToCDR(cdr *models.CDR) {
+	cdr.Caller = r.Caller
+	cdr.Callee = r.Callee
+	cdr.NumberPoolNo = r.Binding.NumberPoolNo
+	cdr.PhoneNoX = r.Binding.PhoneNoX
+	cdr.PhoneNoA = r.Binding.PhoneNoA
+	cdr.PhoneNoB = r.Binding.PhoneNoB
+	cdr.SecretCallType = r.SecretCallType
+}
@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 推送类型
+const (
+	DeliveryKindCDR    = "cdr"
+	DeliveryKindStatus = "status"
+)
+
+// Delivery 一次待投递的推送
+type Delivery struct {
+	ID        string          `json:"id"`
+	Kind      string          `json:"kind"`              // 推送类型：cdr 或 status
+	Account   string          `json:"account,omitempty"` // 推送所属的账号
+	URL       string          `json:"url"`
+	CallID    string          `json:"callId"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempt   int             `json:"attempt"` // 已尝试的次数
+	NextDue   time.Time       `json:"nextDue"` // 下一次尝试的时间
+	CreatedAt time.Time       `json:"createdAt"`
+	History   []AttemptRecord `json:"history,omitempty"` // 每次尝试的结果
+}
+
+// AttemptRecord 一次投递尝试的结果
+type AttemptRecord struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode"` // 未收到响应时为0
+	Error      string    `json:"error,omitempty"`
+}
+
+// outboxRecord 预写日志中的一条记录
+type outboxRecord struct {
+	Op       string    `json:"op"` // put：新增或更新，done：投递结束
+	ID       string    `json:"id,omitempty"`
+	Delivery *Delivery `json:"delivery,omitempty"`
+}
+
+// Outbox 基于预写日志文件的待投递队列
+//
+// 每次新增、更新或完成投递都追加一条记录，启动时重放日志恢复未完成的投递。
+// 日志中的失效记录过多时会重写文件进行压缩。
+type Outbox struct {
+	path    string
+	file    *os.File
+	writer  *bufio.Writer
+	pending map[string]*Delivery
+	records int // 当前日志文件中的记录数
+	mutex   sync.Mutex
+}
+
+// OpenOutbox 打开或创建 dir/name.wal 并重放其中的记录
+func OpenOutbox(dir, name string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建投递队列目录失败: %v", err)
+	}
+
+	o := &Outbox{
+		path:    filepath.Join(dir, name+".wal"),
+		pending: make(map[string]*Delivery),
+	}
+	if err := o.replay(); err != nil {
+		return nil, err
+	}
+
+	// 重放后立即压缩，丢弃已完成的记录
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// replay 读取日志文件恢复待投递记录
+func (o *Outbox) replay() error {
+	file, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开投递队列文件失败: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var record outboxRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 进程被强制终止时最后一行可能不完整，跳过即可
+			log.Printf("跳过投递队列中无法解析的记录 %s:%d: %v", o.path, line, err)
+			continue
+		}
+		switch record.Op {
+		case "put":
+			if record.Delivery != nil {
+				o.pending[record.Delivery.ID] = record.Delivery
+			}
+		case "done":
+			delete(o.pending, record.ID)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取投递队列文件失败: %v", err)
+	}
+	return nil
+}
+
+// compact 仅保留待投递记录重写日志文件
+func (o *Outbox) compact() error {
+	tmpPath := o.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建投递队列临时文件失败: %v", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, d := range o.pending {
+		if err := writeOutboxRecord(writer, outboxRecord{Op: "put", Delivery: d}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入投递队列临时文件失败: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("同步投递队列临时文件失败: %v", err)
+	}
+	tmp.Close()
+
+	if o.file != nil {
+		o.file.Close()
+	}
+	if err := os.Rename(tmpPath, o.path); err != nil {
+		return fmt.Errorf("替换投递队列文件失败: %v", err)
+	}
+
+	file, err := os.OpenFile(o.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开投递队列文件失败: %v", err)
+	}
+	o.file = file
+	o.writer = bufio.NewWriter(file)
+	o.records = len(o.pending)
+	return nil
+}
+
+// writeOutboxRecord 以JSON行格式写入一条记录
+func writeOutboxRecord(writer *bufio.Writer, record outboxRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("JSON序列化失败: %v", err)
+	}
+	data = append(data, '\n')
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("写入投递队列失败: %v", err)
+	}
+	return nil
+}
+
+// append 追加一条记录并写入文件，必要时压缩
+//
+// put 记录写入后同步到磁盘，Put 返回时推送在断电后也不会丢失；done 记录不同步，
+// 断电时丢失的 done 记录只会使已结束的推送在重启后再投递一次。
+func (o *Outbox) append(record outboxRecord) error {
+	if err := writeOutboxRecord(o.writer, record); err != nil {
+		return err
+	}
+	if err := o.writer.Flush(); err != nil {
+		return fmt.Errorf("写入投递队列失败: %v", err)
+	}
+	if record.Op == "put" {
+		if err := o.file.Sync(); err != nil {
+			return fmt.Errorf("同步投递队列文件失败: %v", err)
+		}
+	}
+	o.records++
+
+	// 失效记录超过待投递记录数的2倍时压缩
+	if o.records > 1000 && o.records > 3*len(o.pending) {
+		return o.compact()
+	}
+	return nil
+}
+
+// Put 新增或更新一条待投递记录
+func (o *Outbox) Put(d *Delivery) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	copied := *d
+	copied.History = append([]AttemptRecord(nil), d.History...)
+	o.pending[d.ID] = &copied
+	return o.append(outboxRecord{Op: "put", Delivery: &copied})
+}
+
+// Done 标记投递结束（成功或放弃）
+func (o *Outbox) Done(id string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if _, ok := o.pending[id]; !ok {
+		return nil
+	}
+	delete(o.pending, id)
+	return o.append(outboxRecord{Op: "done", ID: id})
+}
+
+// Pending 返回所有待投递记录，按下一次尝试时间排序
+func (o *Outbox) Pending() []*Delivery {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	deliveries := make([]*Delivery, 0, len(o.pending))
+	for _, d := range o.pending {
+		copied := *d
+		deliveries = append(deliveries, &copied)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].NextDue.Before(deliveries[j].NextDue)
+	})
+	return deliveries
+}
+
+// Len 返回待投递记录数
+func (o *Outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.pending)
+}
+
+// Close 关闭日志文件
+func (o *Outbox) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+	if err := o.writer.Flush(); err != nil {
+		return err
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
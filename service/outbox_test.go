@@ -0,0 +1,177 @@
+package service
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// outboxOp 依次对投递队列执行的操作，如 put:a、put:a:2（已尝试2次）、done:a
+type outboxOp string
+
+// applyOutbox 依次执行操作
+func applyOutbox(t *testing.T, o *Outbox, ops []outboxOp) {
+	t.Helper()
+	for _, op := range ops {
+		parts := strings.Split(string(op), ":")
+		switch parts[0] {
+		case "put":
+			d := &Delivery{ID: parts[1], Kind: DeliveryKindCDR, URL: "http://localhost/cdr"}
+			if len(parts) > 2 {
+				d.Attempt, _ = strconv.Atoi(parts[2])
+			}
+			if err := o.Put(d); err != nil {
+				t.Fatalf("Put(%s) = %v", parts[1], err)
+			}
+		case "done":
+			if err := o.Done(parts[1]); err != nil {
+				t.Fatalf("Done(%s) = %v", parts[1], err)
+			}
+		}
+	}
+}
+
+// pendingAttempts 返回待投递记录的ID及已尝试次数
+func pendingAttempts(o *Outbox) map[string]int {
+	attempts := make(map[string]int)
+	for _, d := range o.Pending() {
+		attempts[d.ID] = d.Attempt
+	}
+	return attempts
+}
+
+// walLines 返回日志文件的行数
+func walLines(t *testing.T, path string) int {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func TestOutboxReplay(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []outboxOp
+		tail string // 关闭后直接追加到日志文件末尾的内容，模拟进程被强制终止
+		want map[string]int
+	}{
+		{
+			name: "未完成的投递",
+			ops:  []outboxOp{"put:a", "put:b", "put:c", "done:b"},
+			want: map[string]int{"a": 0, "c": 0},
+		},
+		{
+			name: "保留最新的尝试次数",
+			ops:  []outboxOp{"put:a", "put:a:1", "put:a:2"},
+			want: map[string]int{"a": 2},
+		},
+		{
+			name: "全部完成",
+			ops:  []outboxOp{"put:a", "done:a"},
+			want: map[string]int{},
+		},
+		{
+			name: "最后一行不完整",
+			ops:  []outboxOp{"put:a", "put:b"},
+			tail: `{"op":"done","id":"a"`,
+			want: map[string]int{"a": 0, "b": 0},
+		},
+		{
+			name: "不完整的行之后的记录",
+			ops:  []outboxOp{"put:a"},
+			tail: "{\"op\":\"put\",\"delivery\":{\"id\":\"x\"\n{\"op\":\"done\",\"id\":\"a\"}\n",
+			want: map[string]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			o, err := OpenOutbox(dir, "test")
+			if err != nil {
+				t.Fatalf("OpenOutbox() = %v", err)
+			}
+			applyOutbox(t, o, tt.ops)
+			if err := o.Close(); err != nil {
+				t.Fatalf("Close() = %v", err)
+			}
+			if tt.tail != "" {
+				file, err := os.OpenFile(filepath.Join(dir, "test.wal"), os.O_WRONLY|os.O_APPEND, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				file.WriteString(tt.tail)
+				file.Close()
+			}
+
+			reopened, err := OpenOutbox(dir, "test")
+			if err != nil {
+				t.Fatalf("重新打开 OpenOutbox() = %v", err)
+			}
+			defer reopened.Close()
+			got := pendingAttempts(reopened)
+			if len(got) != len(tt.want) {
+				t.Fatalf("待投递记录为 %v, 期望 %v", got, tt.want)
+			}
+			for id, attempt := range tt.want {
+				if a, ok := got[id]; !ok || a != attempt {
+					t.Fatalf("待投递记录为 %v, 期望 %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxCompaction(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.wal")
+	o, err := OpenOutbox(dir, "test")
+	if err != nil {
+		t.Fatalf("OpenOutbox() = %v", err)
+	}
+	applyOutbox(t, o, []outboxOp{"put:keep:3"})
+
+	// 大量已完成的投递使失效记录超过阈值，触发压缩
+	for i := 0; i < 600; i++ {
+		id := outboxOp(strconv.Itoa(i))
+		applyOutbox(t, o, []outboxOp{"put:" + id, "done:" + id})
+	}
+	if lines := walLines(t, path); lines >= 1000 {
+		t.Fatalf("日志文件有%d行, 期望已压缩", lines)
+	}
+	if o.records != walLines(t, path) {
+		t.Fatalf("记录数为%d, 日志文件有%d行", o.records, walLines(t, path))
+	}
+
+	// 压缩后继续追加，重放结果不变
+	applyOutbox(t, o, []outboxOp{"put:after"})
+	if err := o.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	reopened, err := OpenOutbox(dir, "test")
+	if err != nil {
+		t.Fatalf("重新打开 OpenOutbox() = %v", err)
+	}
+	defer reopened.Close()
+	got := pendingAttempts(reopened)
+	if len(got) != 2 || got["keep"] != 3 || got["after"] != 0 {
+		t.Fatalf("待投递记录为 %v, 期望 keep（已尝试3次）和 after", got)
+	}
+
+	// 打开时已压缩，只剩待投递记录
+	if lines := walLines(t, path); lines != 2 {
+		t.Fatalf("重新打开后日志文件有%d行, 期望2行", lines)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ComponentStatus 单个组件的检查结果
+type ComponentStatus struct {
+	Status  string `json:"status"`            // "healthy" 或 "unhealthy"
+	Details string `json:"details,omitempty"` // 不健康的原因
+}
+
+// ProbeStatus 存活或就绪检查的结果
+type ProbeStatus struct {
+	Status     string                     `json:"status"` // 任一组件不健康时为 "unhealthy"
+	Timestamp  time.Time                  `json:"timestamp"`
+	Components map[string]ComponentStatus `json:"components"`
+}
+
+// healthy 返回健康的组件状态
+func healthy() ComponentStatus {
+	return ComponentStatus{Status: "healthy"}
+}
+
+// unhealthy 返回不健康的组件状态
+func unhealthy(format string, args ...any) ComponentStatus {
+	return ComponentStatus{Status: "unhealthy", Details: fmt.Sprintf(format, args...)}
+}
+
+// newProbeStatus 汇总各组件的检查结果
+func newProbeStatus(components map[string]ComponentStatus) *ProbeStatus {
+	status := &ProbeStatus{
+		Status:     "healthy",
+		Timestamp:  time.Now(),
+		Components: components,
+	}
+	for _, component := range components {
+		if component.Status != "healthy" {
+			status.Status = "unhealthy"
+		}
+	}
+	return status
+}
+
+// checkLiveness 存活检查：推送工作池和呼叫状态推进循环是否卡死
+func (h *HealthService) checkLiveness() *ProbeStatus {
+	timeout := time.Duration(h.config.Load().Health.StallTimeout) * time.Second
+	components := make(map[string]ComponentStatus)
+
+	if h.pusher != nil {
+		pool := h.pusher.WorkerPool()
+		if pool.Stalled(timeout) {
+			components["workers"] = unhealthy("工作池超过%v没有进展，执行中%d个，等待%d个", timeout, pool.Busy(), pool.QueueDepth())
+		} else {
+			components["workers"] = healthy()
+		}
+	}
+
+	if h.callStatusSvc != nil {
+		if since := time.Since(h.callStatusSvc.LastUpdate()); since > timeout {
+			components["call_lifecycle"] = unhealthy("呼叫状态已%v没有推进", since.Truncate(time.Second))
+		} else {
+			components["call_lifecycle"] = healthy()
+		}
+	}
+	return newProbeStatus(components)
+}
+
+// checkReadiness 就绪检查：推送地址、重试积压、日志目录和工作池队列
+func (h *HealthService) checkReadiness() *ProbeStatus {
+	components := map[string]ComponentStatus{
+		"log_dir": checkDirWritable(LogDir),
+	}
+
+	if h.pusher != nil {
+		window := time.Duration(h.config.Load().Health.EndpointFailureWindow) * time.Second
+		var failing []string
+		for url, duration := range h.pusher.FailingEndpoints() {
+			if duration >= window {
+				failing = append(failing, fmt.Sprintf("%s（%v）", url, duration.Truncate(time.Second)))
+			}
+		}
+		if len(failing) > 0 {
+			sort.Strings(failing)
+			components["endpoints"] = unhealthy("推送地址持续失败: %s", strings.Join(failing, ", "))
+		} else {
+			components["endpoints"] = healthy()
+		}
+
+		if backlog := h.pusher.RetryBacklog(); backlog > h.config.Load().Health.MaxRetryBacklog {
+			components["retry_backlog"] = unhealthy("等待重试的推送数%d超过上限%d", backlog, h.config.Load().Health.MaxRetryBacklog)
+		} else {
+			components["retry_backlog"] = healthy()
+		}
+
+		if pool := h.pusher.WorkerPool(); pool.Saturated() {
+			components["worker_queue"] = unhealthy("工作池队列已满，等待%d个", pool.QueueDepth())
+		} else {
+			components["worker_queue"] = healthy()
+		}
+	}
+	return newProbeStatus(components)
+}
+
+// checkDirWritable 检查目录是否可以创建文件
+func checkDirWritable(dir string) ComponentStatus {
+	file, err := os.CreateTemp(dir, ".health-*")
+	if err != nil {
+		return unhealthy("目录不可写: %v", err)
+	}
+	file.Close()
+	os.Remove(file.Name())
+	return healthy()
+}
+
+// handleLiveness 处理存活检查HTTP请求
+func (h *HealthService) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, h.checkLiveness())
+}
+
+// handleReadiness 处理就绪检查HTTP请求
+func (h *HealthService) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, h.checkReadiness())
+}
+
+// writeProbe 写入检查结果，不健康时返回503
+func writeProbe(w http.ResponseWriter, status *ProbeStatus) {
+	w.Header().Set("Content-Type", "application/json")
+	if status.Status != "healthy" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,751 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cdr/config"
+	"cdr/signature"
+
+	"github.com/google/uuid"
+)
+
+// PushLogFunc 记录单次推送结果的日志函数
+type PushLogFunc func(account string, callID string, url string, requestData []byte, statusCode int, responseErr error)
+
+// ErrPusherClosed 推送器已关闭，不再接受新的推送
+var ErrPusherClosed = errors.New("推送器已关闭")
+
+// kindNames 推送类型在日志中的名称
+var kindNames = map[string]string{
+	DeliveryKindCDR:    "CDR",
+	DeliveryKindStatus: "状态",
+}
+
+// Pusher 负责推送的投递与重试，CDR与状态推送共用
+//
+// 每条推送在投递前写入持久化队列，并随每次失败更新已尝试次数和下一次尝试时间，
+// 进程重启后通过 Resume 按原有重试计划继续投递。
+type Pusher struct {
+	config     atomic.Pointer[config.Config] // 当前配置，重新加载后整体替换
+	outbox     *Outbox
+	workerPool *WorkerPool
+	scheduler  *RetryScheduler
+	deadLetter *DeadLetterStore
+	client     *http.Client
+	batcher    *Batcher                // 未开启批量推送时为nil
+	breakers   *CircuitBreakers        // 未开启熔断时为nil
+	kindLimits map[string]*RateLimiter // 按推送类型限制每秒推送条数
+	urlLimits  map[string]*RateLimiter // 按推送地址限制每秒请求数
+	metrics    *PushMetrics
+	failing    map[string]time.Time // 各推送地址连续失败的开始时间，成功后移除
+	loggers    map[string]PushLogFunc
+	storeDir   string          // 持久化目录，死信管理工具重新投递的推送从其中接收
+	requeued   chan struct{}   // 接收重新投递的协程退出时关闭，Resume 之前为nil
+	unrequeue  chan struct{}   // 关闭后接收重新投递的协程退出
+	ctx        context.Context // 关闭时取消，尚未开始的投递保留在持久化队列中
+	cancel     context.CancelFunc
+	mutex      sync.RWMutex
+}
+
+// PushSummary 本进程推送结果汇总
+type PushSummary struct {
+	Delivered uint64 // 投递成功
+	Abandoned uint64 // 放弃并转入死信
+	Pending   int    // 仍在持久化队列中，下次启动后继续投递
+}
+
+// NewPusher 创建推送器，name 区分不同进程的持久化队列文件
+func NewPusher(cfg *config.Config, name string) (*Pusher, error) {
+	outbox, err := OpenOutbox(cfg.Retry.StoreDir, name)
+	if err != nil {
+		return nil, fmt.Errorf("打开投递队列失败: %v", err)
+	}
+	deadLetter, err := NewDeadLetterStore(cfg.Retry.DeadLetterDir)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewHTTPClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("创建HTTP客户端失败: %v", err)
+	}
+	p := &Pusher{
+		outbox:     outbox,
+		deadLetter: deadLetter,
+		client:     client,
+		workerPool: NewWorkerPool(cfg.Push.Workers),
+		metrics:    NewPushMetrics(),
+		failing:    make(map[string]time.Time),
+		loggers:    make(map[string]PushLogFunc),
+		storeDir:   cfg.Retry.StoreDir,
+	}
+	if cfg.Push.Batch.Enabled {
+		p.batcher = NewBatcher(cfg, p.submitBatch)
+	}
+	if cfg.Push.CircuitBreaker.Enabled {
+		p.breakers = NewCircuitBreakers(cfg)
+	}
+	p.kindLimits = map[string]*RateLimiter{
+		DeliveryKindCDR:    NewRateLimiter(cfg.Rate.CDR, cfg.Rate.Burst),
+		DeliveryKindStatus: NewRateLimiter(cfg.Rate.Status, cfg.Rate.Burst),
+	}
+	p.urlLimits = make(map[string]*RateLimiter, len(cfg.Rate.Endpoints))
+	for url, rate := range cfg.Rate.Endpoints {
+		p.urlLimits[url] = NewRateLimiter(rate, cfg.Rate.Burst)
+	}
+	p.config.Store(cfg)
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.scheduler = NewRetryScheduler(p.dispatch)
+	return p, nil
+}
+
+// ApplyConfig 应用重新加载的配置
+//
+// 速率上限只在配置值修改时替换，未修改时保留管理接口设置的值。
+func (p *Pusher) ApplyConfig(cfg *config.Config) {
+	old := p.config.Swap(cfg)
+	if cfg.Rate.CDR != old.Rate.CDR {
+		p.SetRateLimit(DeliveryKindCDR, cfg.Rate.CDR)
+	}
+	if cfg.Rate.Status != old.Rate.Status {
+		p.SetRateLimit(DeliveryKindStatus, cfg.Rate.Status)
+	}
+	if !reflect.DeepEqual(cfg.Rate.Endpoints, old.Rate.Endpoints) {
+		urlLimits := make(map[string]*RateLimiter, len(cfg.Rate.Endpoints))
+		for url, rate := range cfg.Rate.Endpoints {
+			urlLimits[url] = NewRateLimiter(rate, cfg.Rate.Burst)
+		}
+		p.mutex.Lock()
+		p.urlLimits = urlLimits
+		p.mutex.Unlock()
+	}
+	p.workerPool.Resize(cfg.Push.Workers)
+}
+
+// SetLogger 设置指定推送类型的日志函数
+func (p *Pusher) SetLogger(kind string, logFunc PushLogFunc) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.loggers[kind] = logFunc
+}
+
+// logPush 调用推送类型对应的日志函数
+func (p *Pusher) logPush(d *Delivery, statusCode int, err error) {
+	p.mutex.RLock()
+	logFunc := p.loggers[d.Kind]
+	p.mutex.RUnlock()
+
+	if logFunc != nil {
+		logFunc(d.Account, d.CallID, d.URL, d.Payload, statusCode, err)
+	}
+}
+
+// Push 提交一条推送并立即返回，最终投递结果通过返回的通道异步送达
+//
+// 失败的推送按配置的重试计划交给重试调度器，不占用工作协程。
+// 返回的通道有1个缓冲，调用方不关心结果时可以不读取。
+//
+// ctx 作用于整个投递过程：每次HTTP请求的超时不超过ctx的截止时间，
+// ctx取消后正在进行的请求被中断，不再重试，结果为ctx的错误，并从持久化队列中移除。
+//
+// account 为推送所属的账号，决定签名密钥和重试计划，并作为指标和日志的标签。
+// 推送器关闭后提交的推送，以及关闭时尚未完成的推送，结果为 ErrPusherClosed。
+func (p *Pusher) Push(ctx context.Context, kind, account, callID, url string, payload []byte) <-chan error {
+	if err := ctx.Err(); err != nil {
+		return failedResult(err)
+	}
+	if p.ctx.Err() != nil {
+		return failedResult(ErrPusherClosed)
+	}
+	now := time.Now()
+	item := &pendingDelivery{
+		ctx: ctx,
+		delivery: &Delivery{
+			ID:        uuid.New().String(),
+			Kind:      kind,
+			Account:   account,
+			URL:       url,
+			CallID:    callID,
+			Payload:   payload,
+			NextDue:   now,
+			CreatedAt: now,
+		},
+		result: make(chan error, 1),
+	}
+	if err := p.outbox.Put(item.delivery); err != nil {
+		log.Printf("写入投递队列失败 CallID:%s, Error:%v", callID, err)
+	}
+	p.dispatch(item)
+	return item.result
+}
+
+// failedResult 返回已包含错误的结果通道，用于提交前就失败的推送
+func failedResult(err error) <-chan error {
+	result := make(chan error, 1)
+	result <- err
+	return result
+}
+
+// Resume 将上次进程退出时未完成的推送交给重试调度器，按原有计划继续投递，
+// 并开始接收死信管理工具重新投递的推送
+func (p *Pusher) Resume() {
+	pending := p.outbox.Pending()
+	if len(pending) > 0 {
+		log.Printf("恢复%d条未完成的推送", len(pending))
+	}
+	for _, d := range pending {
+		p.schedule(&pendingDelivery{delivery: d, ctx: context.Background(), result: make(chan error, 1)})
+	}
+
+	p.requeued = make(chan struct{})
+	p.unrequeue = make(chan struct{})
+	go p.watchRequeue()
+}
+
+// watchRequeue 定期接收重新投递目录中的推送，直到推送器开始关闭
+func (p *Pusher) watchRequeue() {
+	defer close(p.requeued)
+	ticker := time.NewTicker(requeueInterval)
+	defer ticker.Stop()
+	for {
+		p.absorbRequeue()
+		select {
+		case <-ticker.C:
+		case <-p.unrequeue:
+			return
+		}
+	}
+}
+
+// absorbRequeue 将重新投递的推送写入投递队列后交给重试调度器，与新提交的推送一样限速、熔断和重试
+func (p *Pusher) absorbRequeue() {
+	files, err := claimRequeue(p.storeDir)
+	if err != nil {
+		log.Printf("接收重新投递的推送失败: %v", err)
+	}
+	for _, file := range files {
+		for _, d := range file.deliveries {
+			if err := p.outbox.Put(d); err != nil {
+				log.Printf("写入投递队列失败 CallID:%s, Error:%v", d.CallID, err)
+			}
+		}
+		if err := os.Remove(file.path); err != nil {
+			log.Printf("删除重新投递文件失败: %v", err)
+		}
+		log.Printf("接收%d条重新投递的推送", len(file.deliveries))
+		for _, d := range file.deliveries {
+			p.schedule(&pendingDelivery{delivery: d, ctx: context.Background(), result: make(chan error, 1)})
+		}
+	}
+}
+
+// schedule 将投递交给重试调度器，等待期间ctx取消时立即移除并结束
+func (p *Pusher) schedule(item *pendingDelivery) {
+	item.unwatch = context.AfterFunc(item.ctx, func() {
+		if p.scheduler.Remove(item) {
+			p.abort(item, item.ctx.Err())
+		}
+	})
+	if !p.scheduler.Schedule(item) {
+		item.unwatch()
+		item.unwatch = nil
+		p.shelve(item)
+	}
+}
+
+// dispatch 将到期的投递交给批量发送器或工作池
+func (p *Pusher) dispatch(item *pendingDelivery) {
+	if item.unwatch != nil {
+		item.unwatch()
+		item.unwatch = nil
+	}
+	if p.batcher != nil && item.delivery.Kind == DeliveryKindCDR {
+		p.batcher.Add(item)
+		return
+	}
+	p.submit(item)
+}
+
+// submit 提交一次投递尝试到工作池
+func (p *Pusher) submit(item *pendingDelivery) {
+	err := p.workerPool.Submit(func() {
+		p.attempt(item)
+	})
+	if err != nil {
+		p.shelve(item)
+	}
+}
+
+// submitBatch 提交一次批量投递尝试到工作池
+func (p *Pusher) submitBatch(items []*pendingDelivery) {
+	err := p.workerPool.Submit(func() {
+		p.attemptBatch(items)
+	})
+	if err != nil {
+		p.shelve(items...)
+	}
+}
+
+// shelve 处理因推送器关闭而未完成的投递，结果为 ErrPusherClosed，
+// 投递保留在持久化队列中，下次启动后继续
+func (p *Pusher) shelve(items ...*pendingDelivery) {
+	for _, item := range items {
+		item.result <- ErrPusherClosed
+	}
+}
+
+// attempt 执行一次投递尝试
+func (p *Pusher) attempt(item *pendingDelivery) {
+	d := item.delivery
+	if p.ctx.Err() != nil {
+		p.shelve(item)
+		return
+	}
+	if err := item.ctx.Err(); err != nil {
+		p.abort(item, err)
+		return
+	}
+	if !p.allow(d.URL) {
+		p.postpone(item)
+		return
+	}
+
+	ctx, cancel := p.attemptContext(item.ctx)
+	defer cancel()
+	if err := p.throttle(ctx, d.Kind, d.URL, 1); err != nil {
+		p.release(d.URL)
+		p.interrupted(item, err)
+		return
+	}
+	p.metrics.recordAttempt(d.Kind, d.Account, d.URL, d.Attempt)
+	if d.Attempt > 0 {
+		log.Printf("%s推送重试 Account:%s, CallID:%s, 第%d次", kindNames[d.Kind], d.Account, d.CallID, d.Attempt)
+	}
+	err := p.post(ctx, d)
+	if err != nil && ctx.Err() != nil {
+		p.interrupted(item, err)
+		return
+	}
+	p.complete(item, err)
+}
+
+// attemptContext 返回一次投递尝试使用的上下文，提交方取消或推送器关闭时都会结束
+func (p *Pusher) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(p.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// interrupted 处理被取消中断的投递尝试，不计入尝试次数
+//
+// 推送器关闭时投递保留在持久化队列中，下次启动后继续；提交方取消时结束投递。
+func (p *Pusher) interrupted(item *pendingDelivery, err error) {
+	if p.ctx.Err() != nil {
+		p.shelve(item)
+		return
+	}
+	if ctxErr := item.ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	p.abort(item, err)
+}
+
+// abort 提交方取消后结束投递，不再重试，也不转入死信
+func (p *Pusher) abort(item *pendingDelivery, err error) {
+	d := item.delivery
+	log.Printf("%s推送已取消 Account:%s, CallID:%s, %v", kindNames[d.Kind], d.Account, d.CallID, err)
+	p.finish(item, err)
+}
+
+// attemptBatch 将同一账号、同一推送地址的多条记录合并为一个请求投递
+//
+// 请求失败时所有记录本次尝试失败；接收方返回 {"rejectedCallIds": [...]} 时
+// 仅列出的记录失败。每条记录按各自的已尝试次数独立重试。
+//
+// 批量请求合并了多个提交方的推送，不受单条推送的ctx中断，已取消的记录在发送前剔除。
+func (p *Pusher) attemptBatch(items []*pendingDelivery) {
+	if p.ctx.Err() != nil {
+		p.shelve(items...)
+		return
+	}
+	active := items[:0]
+	for _, item := range items {
+		if err := item.ctx.Err(); err != nil {
+			p.abort(item, err)
+			continue
+		}
+		active = append(active, item)
+	}
+	items = active
+	if len(items) == 0 {
+		return
+	}
+	first := items[0].delivery
+	if !p.allow(first.URL) {
+		for _, item := range items {
+			p.postpone(item)
+		}
+		return
+	}
+
+	// 只有推送器关闭时等待才会失败
+	if p.throttle(p.ctx, first.Kind, first.URL, len(items)) != nil {
+		p.release(first.URL)
+		p.shelve(items...)
+		return
+	}
+	for _, item := range items {
+		p.metrics.recordAttempt(first.Kind, first.Account, first.URL, item.delivery.Attempt)
+	}
+	body, contentType := encodeBatch(items, p.config.Load().Push.Batch.Format)
+	log.Printf("%s批量推送 Account:%s, %d条", kindNames[first.Kind], first.Account, len(items))
+
+	record := AttemptRecord{Time: time.Now()}
+	result, err := p.sendAndClassify(p.ctx, first.Kind, first.Account, first.URL, contentType, body)
+	if err != nil && p.ctx.Err() != nil {
+		p.shelve(items...)
+		return
+	}
+	statusCode := result.statusCode
+	p.logPush(&Delivery{Kind: first.Kind, Account: first.Account, URL: first.URL, CallID: fmt.Sprintf("批量%d条", len(items)), Payload: body}, statusCode, err)
+
+	var rejected map[string]bool
+	if err == nil {
+		rejected = parseRejected(result.body)
+	}
+	for _, item := range items {
+		itemErr := err
+		if itemErr == nil && rejected[item.delivery.CallID] {
+			itemErr = fmt.Errorf("批量推送中该记录被接收方拒绝")
+		}
+
+		itemRecord := record
+		itemRecord.StatusCode = statusCode
+		if itemErr != nil {
+			itemRecord.Error = itemErr.Error()
+		}
+		item.delivery.History = append(item.delivery.History, itemRecord)
+		p.complete(item, itemErr)
+	}
+}
+
+// allow 判断推送地址的熔断器是否放行请求
+func (p *Pusher) allow(url string) bool {
+	return p.breakers == nil || p.breakers.Get(url).Allow()
+}
+
+// release 归还 allow 放行后未发送的请求占用的熔断器名额
+func (p *Pusher) release(url string) {
+	if p.breakers != nil {
+		p.breakers.Get(url).Cancel()
+	}
+}
+
+// throttle 按推送类型和推送地址的速率限制等待，count 为本次请求包含的记录数
+//
+// ctx结束时返回其错误，本次投递不再进行。
+func (p *Pusher) throttle(ctx context.Context, kind, url string, count int) error {
+	p.mutex.RLock()
+	kindLimit, urlLimit := p.kindLimits[kind], p.urlLimits[url]
+	p.mutex.RUnlock()
+	if err := kindLimit.WaitN(ctx, count); err != nil {
+		return err
+	}
+	return urlLimit.Wait(ctx)
+}
+
+// SetRateLimit 修改推送类型每秒推送条数的上限，rate为0时不限速
+func (p *Pusher) SetRateLimit(kind string, rate float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if limiter := p.kindLimits[kind]; limiter != nil && rate > 0 {
+		limiter.SetRate(rate)
+		return
+	}
+	p.kindLimits[kind] = NewRateLimiter(rate, p.config.Load().Rate.Burst)
+}
+
+// RateLimit 返回推送类型每秒推送条数的上限，0表示不限速
+func (p *Pusher) RateLimit(kind string) float64 {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.kindLimits[kind].Rate()
+}
+
+// postpone 熔断期间不发送，按熔断器的恢复时间重新进入重试队列，不计入尝试次数
+func (p *Pusher) postpone(item *pendingDelivery) {
+	d := item.delivery
+	d.NextDue = p.breakers.Get(d.URL).RetryAt()
+	log.Printf("%s推送地址熔断中 Account:%s, CallID:%s, %s后重新尝试", kindNames[d.Kind], d.Account, d.CallID, d.NextDue.Format("15:04:05"))
+	if err := p.outbox.Put(d); err != nil {
+		log.Printf("更新投递队列失败 CallID:%s, Error:%v", d.CallID, err)
+	}
+	p.schedule(item)
+}
+
+// CircuitStates 返回各推送地址的熔断器状态，未开启熔断时返回nil
+func (p *Pusher) CircuitStates() map[string]string {
+	if p.breakers == nil {
+		return nil
+	}
+	return p.breakers.States()
+}
+
+// WriteMetrics 输出推送统计、工作池、重试队列和死信的指标
+func (p *Pusher) WriteMetrics(w *MetricWriter) {
+	p.metrics.write(w)
+
+	w.Gauge("cdrpush_workers", "推送工作协程数", float64(p.workerPool.Size()))
+	w.Gauge("cdrpush_worker_busy", "正在执行推送的工作协程数", float64(p.workerPool.Busy()))
+	w.Gauge("cdrpush_worker_queue_depth", "工作池中等待执行的任务数", float64(p.workerPool.QueueDepth()))
+	w.Gauge("cdrpush_retry_queue_size", "等待重试的推送数", float64(p.scheduler.Len()))
+
+	// 死信文件可能被管理工具修改，按文件内容统计，每次只读取新追加的部分
+	counts, err := p.deadLetter.Counts()
+	if err != nil {
+		log.Printf("统计死信失败: %v", err)
+	}
+	w.Header("cdrpush_dead_letters", "死信目录中的推送数", "gauge")
+	for _, key := range sortedPushKeys(counts) {
+		w.Sample("cdrpush_dead_letters", float64(counts[key]), key.labels()...)
+	}
+}
+
+// trackEndpoint 记录推送地址连续失败的开始时间
+func (p *Pusher) trackEndpoint(url string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if err == nil {
+		delete(p.failing, url)
+	} else if _, ok := p.failing[url]; !ok {
+		p.failing[url] = time.Now()
+	}
+}
+
+// FailingEndpoints 返回正在连续失败的推送地址及已持续的时间
+func (p *Pusher) FailingEndpoints() map[string]time.Duration {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	failing := make(map[string]time.Duration, len(p.failing))
+	for url, since := range p.failing {
+		failing[url] = time.Since(since)
+	}
+	return failing
+}
+
+// RetryBacklog 返回等待重试的推送数
+func (p *Pusher) RetryBacklog() int {
+	return p.scheduler.Len()
+}
+
+// WorkerPool 返回推送使用的工作池
+func (p *Pusher) WorkerPool() *WorkerPool {
+	return p.workerPool
+}
+
+// complete 处理一次投递尝试的结果，失败时交给重试调度器或在重试次数用尽后结束
+func (p *Pusher) complete(item *pendingDelivery, err error) {
+	d := item.delivery
+	name := kindNames[d.Kind]
+	d.Attempt++
+	p.metrics.recordResult(d.Kind, d.Account, d.URL, err)
+	p.trackEndpoint(d.URL, err)
+	if err == nil {
+		log.Printf("%s推送成功 Account:%s, CallID:%s", name, d.Account, d.CallID)
+		p.finish(item, nil)
+		return
+	}
+	log.Printf("%s推送失败 Account:%s, CallID:%s, Error:%v", name, d.Account, d.CallID, err)
+
+	// 重试计划取账号当前的配置，账号已从配置中移除时使用全局配置
+	var perr *pushError
+	errors.As(err, &perr)
+	cfg := p.config.Load()
+	times, delays := cfg.RetryFor(cfg.FindAccount(d.Account))
+	if d.Attempt >= times || (perr != nil && perr.permanent) {
+		err = fmt.Errorf("%s推送尝试%d次失败，最后错误: %v", name, d.Attempt, err)
+		log.Printf("放弃推送 Account:%s, CallID:%s, %v", d.Account, d.CallID, err)
+		if dlErr := p.deadLetter.Add(d, err); dlErr != nil {
+			log.Printf("写入死信失败 CallID:%s, Error:%v", d.CallID, dlErr)
+		}
+		p.metrics.recordDeadLetter(d.Kind, d.Account, d.URL)
+		p.finish(item, err)
+		return
+	}
+
+	// 记录已尝试次数和下一次尝试时间，保证重启后按原计划继续
+	// 重新加载后重试间隔可能变少，超出部分使用最后一个间隔
+	delay := time.Duration(delays[min(d.Attempt, len(delays)-1)]) * time.Second
+	if perr != nil && perr.retryAfter > 0 {
+		delay = perr.retryAfter
+	}
+	d.NextDue = time.Now().Add(delay)
+	if err := p.outbox.Put(d); err != nil {
+		log.Printf("更新投递队列失败 CallID:%s, Error:%v", d.CallID, err)
+	}
+	log.Printf("%s推送等待重试 Account:%s, CallID:%s, 第%d次, %v后", name, d.Account, d.CallID, d.Attempt, delay)
+	p.schedule(item)
+}
+
+// post 执行一次单条HTTP推送，并将结果记录到投递历史中
+func (p *Pusher) post(ctx context.Context, d *Delivery) error {
+	record := AttemptRecord{Time: time.Now()}
+	result, err := p.sendAndClassify(ctx, d.Kind, d.Account, d.URL, "application/json", d.Payload)
+	p.logPush(d, result.statusCode, err)
+
+	record.StatusCode = result.statusCode
+	if err != nil {
+		record.Error = err.Error()
+	}
+	d.History = append(d.History, record)
+	return err
+}
+
+// sendResult 一次HTTP请求的响应
+type sendResult struct {
+	statusCode int // 未收到响应时为0
+	header     http.Header
+	body       []byte
+}
+
+// send 发送一次HTTP请求，返回响应；err仅表示未收到完整响应
+//
+// 请求的超时取推送类型的读取超时和ctx截止时间中较早的一个。
+func (p *Pusher) send(ctx context.Context, kind, account, url, contentType string, body []byte) (*sendResult, error) {
+	result := &sendResult{}
+	ctx, cancel := context.WithTimeout(ctx, p.timeout(kind))
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return result, fmt.Errorf("创建HTTP请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	// 配置了账号密钥时对请求签名，每次尝试使用新的时间戳和随机串
+	cfg := p.config.Load()
+	if secret := cfg.SecretFor(cfg.FindAccount(account)); secret != "" {
+		signature.SignRequest(req, secret, body)
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	p.metrics.observeLatency(kind, account, url, time.Since(start))
+	if err != nil {
+		return result, fmt.Errorf("HTTP请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	result.statusCode = resp.StatusCode
+	result.header = resp.Header
+
+	// 读完响应体以便复用连接
+	result.body, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return result, fmt.Errorf("读取响应失败: %v", err)
+	}
+	return result, nil
+}
+
+// sendAndClassify 发送请求并按响应分类策略判断结果
+//
+// 未收到响应、5xx和429计入熔断器的失败次数，因ctx取消而中断的请求不计入。
+func (p *Pusher) sendAndClassify(ctx context.Context, kind, account, url, contentType string, body []byte) (*sendResult, error) {
+	result, err := p.send(ctx, kind, account, url, contentType, body)
+	if err != nil && ctx.Err() != nil {
+		p.release(url)
+		return result, err
+	}
+	if p.breakers != nil {
+		p.breakers.Get(url).Record(err != nil || result.statusCode >= 500 || result.statusCode == http.StatusTooManyRequests)
+	}
+	if err != nil {
+		return result, err
+	}
+	return result, p.classify(result.statusCode, result.header, result.body)
+}
+
+// timeout 返回推送类型对应地址的读取超时
+func (p *Pusher) timeout(kind string) time.Duration {
+	push := p.config.Load().Push
+	seconds := push.HTTP.ReadTimeout
+	switch {
+	case kind == DeliveryKindCDR && push.CdrTimeout > 0:
+		seconds = push.CdrTimeout
+	case kind == DeliveryKindStatus && push.StatusTimeout > 0:
+		seconds = push.StatusTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// finish 从持久化队列中移除已结束的投递并送达结果
+func (p *Pusher) finish(item *pendingDelivery, err error) {
+	if err := p.outbox.Done(item.delivery.ID); err != nil {
+		log.Printf("更新投递队列失败 CallID:%s, Error:%v", item.delivery.CallID, err)
+	}
+	item.result <- err
+}
+
+// Drain 发送正在积累的批次并等待工作池中的投递完成，ctx结束时返回其错误
+//
+// 等待重试的推送不在此等待，关闭后保留在持久化队列中。
+func (p *Pusher) Drain(ctx context.Context) error {
+	if p.batcher != nil {
+		p.batcher.Flush()
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for !p.workerPool.Idle() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Summary 返回本进程的推送结果汇总
+func (p *Pusher) Summary() PushSummary {
+	delivered, abandoned := p.metrics.totals()
+	return PushSummary{
+		Delivered: delivered,
+		Abandoned: abandoned,
+		Pending:   p.outbox.Len(),
+	}
+}
+
+// Close 关闭推送器，未完成的推送保留在持久化队列中，下次启动后继续投递
+//
+// 先停止接收重新投递和重试调度，发送正在积累的批次，等待工作池中的投递完成，
+// ctx结束后中断仍在进行的投递，最后关闭工作池和持久化队列。
+// 等待重试和被中断的推送结果为 ErrPusherClosed。
+func (p *Pusher) Close(ctx context.Context) error {
+	if p.requeued != nil {
+		close(p.unrequeue)
+		<-p.requeued
+	}
+	p.shelve(p.scheduler.Close()...)
+	if p.batcher != nil {
+		p.batcher.Close()
+	}
+	if err := p.Drain(ctx); err != nil {
+		log.Printf("等待推送完成超时，中断剩余的推送")
+	}
+	p.cancel()
+	p.workerPool.Close()
+	return p.outbox.Close()
+}
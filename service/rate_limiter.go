@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter 令牌桶限速器，nil表示不限速
+//
+// 令牌不足时预支令牌并等待到令牌补足的时间，多个调用方按到达顺序排队，
+// 长时间运行时的实际速率与配置速率一致。
+type RateLimiter struct {
+	rate   float64 // 每秒补充的令牌数
+	burst  float64 // 令牌桶容量
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// NewRateLimiter 创建限速器，rate 为每秒允许的次数，rate不大于0时返回nil（不限速）
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait 等待一个令牌，ctx取消时返回其错误
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN 等待n个令牌，n可以超过令牌桶容量，ctx取消时返回其错误
+func (l *RateLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return ctx.Err()
+	}
+
+	l.mutex.Lock()
+	// 速率被设置为0时暂停放行，等待速率恢复
+	for l.rate <= 0 {
+		l.mutex.Unlock()
+		if err := sleepContext(ctx, 100*time.Millisecond); err != nil {
+			return err
+		}
+		l.mutex.Lock()
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mutex.Unlock()
+
+	return sleepContext(ctx, wait)
+}
+
+// sleepContext 等待指定时长，ctx取消时提前返回其错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetRate 修改每秒允许的次数，rate不大于0时暂停放行
+func (l *RateLimiter) SetRate(rate float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.rate = rate
+}
+
+// Rate 返回每秒允许的次数，nil表示不限速，返回0
+func (l *RateLimiter) Rate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rate
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// requeueDirName 持久化目录下等待推送器接收的重新投递文件所在的子目录
+//
+// 死信管理工具不直接修改运行中推送器的投递队列，而是把死信写成一个新文件放在这里，
+// 推送器定期接收这些文件，写入自己的投递队列后按正常的限速、熔断和重试计划投递。
+// 多个推送器共用同一持久化目录时，每个文件只会被其中一个接收。
+const requeueDirName = "requeue"
+
+// requeueInterval 推送器检查重新投递目录的间隔
+const requeueInterval = 2 * time.Second
+
+// WriteRequeue 将推送写入 storeDir 下的重新投递目录，运行中的推送器或下次启动的推送器会接收并投递
+//
+// 写入的推送已尝试次数清零，立即到期。先写临时文件再改名，推送器不会读到不完整的文件。
+func WriteRequeue(storeDir string, deliveries []*Delivery) error {
+	dir := filepath.Join(storeDir, requeueDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("创建重新投递目录失败: %v", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf("%d-%d.jsonl", time.Now().UnixNano(), os.Getpid()))
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("创建重新投递文件失败: %v", err)
+	}
+
+	now := time.Now()
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, d := range deliveries {
+		copied := *d
+		copied.Attempt = 0
+		copied.NextDue = now
+		if err := encoder.Encode(&copied); err != nil {
+			file.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("JSON序列化失败: %v", err)
+		}
+	}
+	if err := writer.Flush(); err == nil {
+		err = file.Sync()
+	}
+	file.Close()
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入重新投递文件失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名重新投递文件失败: %v", err)
+	}
+	return nil
+}
+
+// requeueFile 推送器已接收、尚未写入投递队列的重新投递文件
+type requeueFile struct {
+	path       string // 接收后改名的路径，写入投递队列后删除
+	deliveries []*Delivery
+}
+
+// claimRequeue 接收重新投递目录中的文件，按写入顺序返回
+//
+// 接收通过改名完成，改名失败说明文件已被其他推送器接收，跳过即可。
+func claimRequeue(storeDir string) ([]requeueFile, error) {
+	paths, err := filepath.Glob(filepath.Join(storeDir, requeueDirName, "*.jsonl"))
+	if err != nil || len(paths) == 0 {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var files []requeueFile
+	for _, path := range paths {
+		claimed := fmt.Sprintf("%s.%d.claimed", path, os.Getpid())
+		if err := os.Rename(path, claimed); err != nil {
+			continue
+		}
+		deliveries, err := readRequeue(claimed)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, requeueFile{path: claimed, deliveries: deliveries})
+	}
+	return files, nil
+}
+
+// readRequeue 读取重新投递文件中的推送
+func readRequeue(path string) ([]*Delivery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开重新投递文件失败: %v", err)
+	}
+	defer file.Close()
+
+	var deliveries []*Delivery
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var d Delivery
+		if err := json.Unmarshal(scanner.Bytes(), &d); err != nil || d.ID == "" {
+			log.Printf("跳过重新投递文件中无法解析的记录 %s: %v", path, err)
+			continue
+		}
+		deliveries = append(deliveries, &d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取重新投递文件失败: %v", err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// pushError 推送失败的原因及其对重试的影响
+type pushError struct {
+	err        error
+	permanent  bool          // 不可重试，直接放弃
+	retryAfter time.Duration // 接收方要求的重试间隔，大于0时覆盖重试计划
+}
+
+func (e *pushError) Error() string { return e.err.Error() }
+
+func (e *pushError) Unwrap() error { return e.err }
+
+// bodyCode 部分接收方约定的响应体格式，code为0表示成功
+type bodyCode struct {
+	Code *json.Number `json:"code"`
+}
+
+// classify 根据响应判断推送是否成功以及失败后是否重试
+//
+// 2xx为成功；配置的不可重试状态码直接失败；配置的限流状态码（默认429、503）
+// 按 Retry-After 响应头决定下一次尝试时间。开启 check_body_code 后，
+// 2xx响应体中的code不为0时视为可重试的失败。
+func (p *Pusher) classify(statusCode int, header http.Header, body []byte) error {
+	if statusCode >= 200 && statusCode < 300 {
+		if !p.config.Load().Push.CheckBodyCode {
+			return nil
+		}
+		var resp bodyCode
+		if json.Unmarshal(body, &resp) != nil || resp.Code == nil || resp.Code.String() == "0" {
+			return nil
+		}
+		return &pushError{err: fmt.Errorf("推送失败，响应码: %s", resp.Code.String())}
+	}
+
+	err := &pushError{err: fmt.Errorf("推送失败，状态码: %d", statusCode)}
+	for _, code := range p.config.Load().Retry.NonRetryableCodes {
+		if statusCode == code {
+			err.permanent = true
+			err.err = fmt.Errorf("推送失败，不可重试的状态码: %d", statusCode)
+			return err
+		}
+	}
+	for _, code := range p.config.Load().Retry.RetryAfterCodes {
+		if statusCode == code {
+			err.retryAfter = p.parseRetryAfter(header.Get("Retry-After"))
+			break
+		}
+	}
+	return err
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（秒数或HTTP日期），超过上限时取上限
+func (p *Pusher) parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = time.Until(at)
+	}
+	if wait <= 0 {
+		return 0
+	}
+
+	if limit := time.Duration(p.config.Load().Retry.MaxRetryAfter) * time.Second; wait > limit {
+		wait = limit
+	}
+	return wait
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// pendingDelivery 等待投递的推送及其结果通道
+type pendingDelivery struct {
+	delivery *Delivery
+	ctx      context.Context // 提交方的上下文，取消后不再重试
+	result   chan error      // 最终投递结果，缓冲为1，调用方可以不读取
+	index    int             // 在deliveryQueue中的位置
+	unwatch  func() bool     // 停止监听ctx取消，等待重试期间有效
+}
+
+// deliveryQueue 按下一次尝试时间排序的最小堆，实现 heap.Interface
+type deliveryQueue []*pendingDelivery
+
+func (q deliveryQueue) Len() int { return len(q) }
+
+func (q deliveryQueue) Less(i, j int) bool {
+	return q[i].delivery.NextDue.Before(q[j].delivery.NextDue)
+}
+
+func (q deliveryQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *deliveryQueue) Push(x any) {
+	item := x.(*pendingDelivery)
+	item.index = len(*q)
+	*q = append(*q, item)
+}
+
+func (q *deliveryQueue) Pop() any {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*q = old[:n-1]
+	return item
+}
+
+// RetryScheduler 重试调度器
+//
+// 失败的推送按下一次尝试时间暂存在堆中，由单个调度协程在到期时交给 dispatch 处理，
+// 工作协程不再因等待重试间隔而被占用。
+type RetryScheduler struct {
+	queue    deliveryQueue
+	dispatch func(item *pendingDelivery)
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	closed   bool // 关闭后 Schedule 不再接收推送
+	mutex    sync.Mutex
+}
+
+// NewRetryScheduler 创建并启动重试调度器
+func NewRetryScheduler(dispatch func(item *pendingDelivery)) *RetryScheduler {
+	s := &RetryScheduler{
+		dispatch: dispatch,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Schedule 暂存一条推送，到达下一次尝试时间后分发，调度器已关闭时返回false
+func (s *RetryScheduler) Schedule(item *pendingDelivery) bool {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return false
+	}
+	heap.Push(&s.queue, item)
+	first := item.index == 0
+	s.mutex.Unlock()
+
+	// 新的记录最早到期时唤醒调度协程重新计时
+	if first {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// Remove 从堆中移除一条尚未分发的推送，已分发或不在堆中时返回false
+func (s *RetryScheduler) Remove(item *pendingDelivery) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if item.index < 0 || item.index >= s.queue.Len() || s.queue[item.index] != item {
+		return false
+	}
+	heap.Remove(&s.queue, item.index)
+	return true
+}
+
+// Len 返回等待重试的推送数
+func (s *RetryScheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.queue.Len()
+}
+
+// run 调度协程，等待最早到期的推送并分发
+func (s *RetryScheduler) run() {
+	defer close(s.stopped)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		now := time.Now()
+		var due []*pendingDelivery
+		wait := time.Hour
+
+		s.mutex.Lock()
+		for s.queue.Len() > 0 && !s.queue[0].delivery.NextDue.After(now) {
+			due = append(due, heap.Pop(&s.queue).(*pendingDelivery))
+		}
+		if s.queue.Len() > 0 {
+			wait = s.queue[0].delivery.NextDue.Sub(now)
+		}
+		s.mutex.Unlock()
+
+		for _, item := range due {
+			s.dispatch(item)
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close 停止调度协程并返回尚未到期的推送，这些推送保留在持久化队列中
+func (s *RetryScheduler) Close() []*pendingDelivery {
+	close(s.done)
+	<-s.stopped
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	remaining := make([]*pendingDelivery, 0, s.queue.Len())
+	for s.queue.Len() > 0 {
+		remaining = append(remaining, heap.Pop(&s.queue).(*pendingDelivery))
+	}
+	return remaining
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// scheduledItem 创建下一次尝试时间为 now+due 的推送
+func scheduledItem(id string, due time.Duration) *pendingDelivery {
+	return &pendingDelivery{
+		delivery: &Delivery{ID: id, NextDue: time.Now().Add(due)},
+		ctx:      context.Background(),
+		result:   make(chan error, 1),
+	}
+}
+
+// dispatchTo 创建把分发的推送写入 dispatched 的重试调度器
+func dispatchTo(dispatched chan<- *pendingDelivery) *RetryScheduler {
+	return NewRetryScheduler(func(item *pendingDelivery) {
+		dispatched <- item
+	})
+}
+
+// collectDispatched 等待 n 条推送被分发，返回分发顺序
+func collectDispatched(t *testing.T, dispatched <-chan *pendingDelivery, n int) []string {
+	t.Helper()
+	var ids []string
+	for len(ids) < n {
+		select {
+		case item := <-dispatched:
+			ids = append(ids, item.delivery.ID)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("只分发了 %v, 期望%d条", ids, n)
+		}
+	}
+	return ids
+}
+
+func TestRetrySchedulerOrder(t *testing.T) {
+	dispatched := make(chan *pendingDelivery, 10)
+	s := dispatchTo(dispatched)
+	defer s.Close()
+
+	// 后加入但更早到期的推送先分发
+	s.Schedule(scheduledItem("c", 150*time.Millisecond))
+	s.Schedule(scheduledItem("a", 50*time.Millisecond))
+	s.Schedule(scheduledItem("b", 100*time.Millisecond))
+	s.Schedule(scheduledItem("now", -time.Second))
+
+	got := collectDispatched(t, dispatched, 4)
+	want := []string{"now", "a", "b", "c"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("分发顺序为 %v, 期望 %v", got, want)
+		}
+	}
+	if s.Len() != 0 {
+		t.Fatalf("Len() = %d, 期望0", s.Len())
+	}
+}
+
+func TestRetrySchedulerRemove(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove []string // 依次移除的推送
+		want   []bool   // 每次移除的返回值
+		rest   []string // 剩余推送的分发顺序
+	}{
+		{"移除最早到期的", []string{"a"}, []bool{true}, []string{"b", "c", "d"}},
+		{"移除中间的", []string{"c"}, []bool{true}, []string{"a", "b", "d"}},
+		{"移除最后到期的", []string{"d"}, []bool{true}, []string{"a", "b", "c"}},
+		{"重复移除", []string{"b", "b"}, []bool{true, false}, []string{"a", "c", "d"}},
+		{"全部移除", []string{"d", "a", "c", "b"}, []bool{true, true, true, true}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatched := make(chan *pendingDelivery, 10)
+			s := dispatchTo(dispatched)
+			defer s.Close()
+
+			items := make(map[string]*pendingDelivery)
+			for i, id := range []string{"a", "b", "c", "d"} {
+				items[id] = scheduledItem(id, time.Duration(50*(i+1))*time.Millisecond)
+			}
+			// 打乱加入顺序，移除后的堆仍按到期时间排序
+			for _, id := range []string{"c", "a", "d", "b"} {
+				s.Schedule(items[id])
+			}
+
+			for i, id := range tt.remove {
+				if got := s.Remove(items[id]); got != tt.want[i] {
+					t.Fatalf("第%d次 Remove(%s) = %v, 期望 %v", i+1, id, got, tt.want[i])
+				}
+			}
+			if s.Len() != len(tt.rest) {
+				t.Fatalf("Len() = %d, 期望%d", s.Len(), len(tt.rest))
+			}
+			got := collectDispatched(t, dispatched, len(tt.rest))
+			for i := range tt.rest {
+				if got[i] != tt.rest[i] {
+					t.Fatalf("分发顺序为 %v, 期望 %v", got, tt.rest)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrySchedulerRemoveDispatched(t *testing.T) {
+	dispatched := make(chan *pendingDelivery, 1)
+	s := dispatchTo(dispatched)
+	defer s.Close()
+
+	item := scheduledItem("a", 0)
+	s.Schedule(item)
+	collectDispatched(t, dispatched, 1)
+	if s.Remove(item) {
+		t.Fatal("已分发的推送 Remove() = true")
+	}
+}
+
+func TestRetrySchedulerClose(t *testing.T) {
+	dispatched := make(chan *pendingDelivery, 1)
+	s := dispatchTo(dispatched)
+	s.Schedule(scheduledItem("a", time.Hour))
+	s.Schedule(scheduledItem("b", time.Minute))
+
+	// 关闭时返回尚未到期的推送，之后不再接收
+	remaining := s.Close()
+	if len(remaining) != 2 || remaining[0].delivery.ID != "b" || remaining[1].delivery.ID != "a" {
+		t.Fatalf("Close() 返回%d条推送, 期望按到期时间排列的 b、a", len(remaining))
+	}
+	if s.Schedule(scheduledItem("c", 0)) {
+		t.Fatal("关闭后 Schedule() = true")
+	}
+	if s.Len() != 0 {
+		t.Fatalf("关闭后 Len() = %d, 期望0", s.Len())
+	}
+}
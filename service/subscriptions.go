@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"cdr/config"
+	"cdr/models"
+)
+
+// Subscription 一个状态事件订阅
+type Subscription struct {
+	ID          string `json:"id"`
+	Account     string `json:"account,omitempty"`    // 只接收该账号的事件，为空时接收所有账号
+	URL         string `json:"url"`                  // 回调地址
+	EventTypes  []int  `json:"eventTypes,omitempty"` // 接收的事件类型，为空时接收全部
+	MessageType int    `json:"messageType"`          // 推送消息中的 messageType
+}
+
+// matches 判断订阅是否接收指定账号的事件
+func (s *Subscription) matches(account string, eventType int) bool {
+	if s.Account != "" && s.Account != account {
+		return false
+	}
+	return len(s.EventTypes) == 0 || slices.Contains(s.EventTypes, eventType)
+}
+
+// validate 检查通过管理接口提交的订阅
+func (s *Subscription) validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("id不能为空")
+	}
+	if s.URL == "" {
+		return fmt.Errorf("url不能为空")
+	}
+	if err := config.CheckURL(s.URL); err != nil {
+		return fmt.Errorf("url%v", err)
+	}
+	for _, eventType := range s.EventTypes {
+		if !models.ValidEventType(eventType) {
+			return fmt.Errorf("不支持的事件类型: %d", eventType)
+		}
+	}
+	if s.MessageType < 0 {
+		return fmt.Errorf("messageType不能为负数")
+	}
+	return nil
+}
+
+// SubscriptionRegistry 状态事件订阅表，从配置加载，可通过管理接口增删
+type SubscriptionRegistry struct {
+	subs  map[string]*Subscription
+	mutex sync.RWMutex
+}
+
+// NewSubscriptionRegistry 创建订阅表并加载配置中的订阅
+func NewSubscriptionRegistry(subs []config.SubscriptionConfig) *SubscriptionRegistry {
+	r := &SubscriptionRegistry{}
+	r.Replace(subs)
+	return r
+}
+
+// Replace 用配置中的订阅替换整个订阅表，管理接口的修改随之丢弃
+func (r *SubscriptionRegistry) Replace(subs []config.SubscriptionConfig) {
+	registry := make(map[string]*Subscription, len(subs))
+	for _, sub := range subs {
+		registry[sub.ID] = &Subscription{
+			ID:          sub.ID,
+			Account:     sub.Account,
+			URL:         sub.URL,
+			EventTypes:  sub.EventTypes,
+			MessageType: sub.MessageType,
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.subs = registry
+}
+
+// Put 添加或替换一个订阅，messageType 为0时使用1
+func (r *SubscriptionRegistry) Put(sub Subscription) error {
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	if sub.MessageType == 0 {
+		sub.MessageType = 1
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.subs[sub.ID] = &sub
+	return nil
+}
+
+// Remove 删除一个订阅，返回订阅是否存在
+func (r *SubscriptionRegistry) Remove(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.subs[id]
+	delete(r.subs, id)
+	return ok
+}
+
+// List 返回按ID排序的全部订阅
+func (r *SubscriptionRegistry) List() []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	list := make([]Subscription, 0, len(r.subs))
+	for _, sub := range r.subs {
+		list = append(list, *sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Len 返回订阅数
+func (r *SubscriptionRegistry) Len() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.subs)
+}
+
+// Match 返回接收指定账号和事件类型的订阅，按ID排序
+func (r *SubscriptionRegistry) Match(account string, eventType int) []Subscription {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var matched []Subscription
+	for _, sub := range r.subs {
+		if sub.matches(account, eventType) {
+			matched = append(matched, *sub)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ID < matched[j].ID })
+	return matched
+}
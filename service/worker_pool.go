@@ -1,50 +1,187 @@
 package service
 
 import (
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrPoolClosed 工作池已关闭，不再接受任务
+var ErrPoolClosed = errors.New("工作池已关闭")
+
 // WorkerPool 工作池结构体
 type WorkerPool struct {
-	workerCount int
+	live       int32           // 运行中的工作协程数，包括已通知退出、正在完成当前任务的
+	stops      []chan struct{} // 每个工作协程的退出通知，数量为调整后的工作协程数
+	mutex      sync.Mutex
 	jobQueue   chan func()
+	busy       int32 // 正在执行任务的工作协程数
+	lastActive int64 // 最近一次任务开始或结束的时间（UnixNano）
+	pending    int64 // 已提交但尚未执行完的任务数
 	wg         sync.WaitGroup
+	closed     bool           // 关闭后 Submit 返回 ErrPoolClosed
+	done       chan struct{}  // 关闭时关闭，唤醒因任务队列已满而阻塞的提交
+	submitting sync.WaitGroup // 正在进行的提交，全部结束后才能关闭任务队列
+	closeMutex sync.RWMutex   // 保护 closed，检查与登记提交在同一把锁内完成
 }
 
 // NewWorkerPool 创建新的工作池
 func NewWorkerPool(workerCount int) *WorkerPool {
 	pool := &WorkerPool{
-		workerCount: workerCount,
 		jobQueue:   make(chan func(), workerCount*2), // 任务队列容量设为工作协程数的2倍
+		lastActive: time.Now().UnixNano(),
+		done:       make(chan struct{}),
 	}
 
 	// 启动工作协程
-	pool.wg.Add(workerCount)
 	for i := 0; i < workerCount; i++ {
-		go pool.worker()
+		pool.start()
 	}
 
 	return pool
 }
 
-// worker 工作协程
-func (p *WorkerPool) worker() {
+// start 启动一个工作协程，调用方需持有锁或在工作池创建时调用
+func (p *WorkerPool) start() {
+	stop := make(chan struct{})
+	p.stops = append(p.stops, stop)
+	p.wg.Add(1)
+	atomic.AddInt32(&p.live, 1)
+	go p.worker(stop)
+}
+
+// worker 工作协程，收到退出通知后完成当前任务再退出，空闲时立即退出
+func (p *WorkerPool) worker(stop <-chan struct{}) {
 	defer p.wg.Done()
+	defer atomic.AddInt32(&p.live, -1)
 
-	for job := range p.jobQueue {
-		job()
+	for {
+		// 优先响应退出通知，避免已通知退出的工作协程继续领取任务
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		select {
+		case job, ok := <-p.jobQueue:
+			if !ok {
+				return
+			}
+			atomic.AddInt32(&p.busy, 1)
+			atomic.StoreInt64(&p.lastActive, time.Now().UnixNano())
+			job()
+			atomic.StoreInt64(&p.lastActive, time.Now().UnixNano())
+			atomic.AddInt32(&p.busy, -1)
+			atomic.AddInt64(&p.pending, -1)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Resize 调整工作协程数，增加时立即启动；减少时通知多出的工作协程退出，
+// 空闲的立即退出，正在执行任务的完成当前任务后退出
+//
+// 任务队列容量在创建时确定，不随之调整。
+func (p *WorkerPool) Resize(workerCount int) {
+	p.closeMutex.RLock()
+	defer p.closeMutex.RUnlock()
+	if p.closed {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for len(p.stops) < workerCount {
+		p.start()
+	}
+	for len(p.stops) > workerCount && len(p.stops) > 0 {
+		last := len(p.stops) - 1
+		close(p.stops[last])
+		p.stops = p.stops[:last]
 	}
 }
 
-// Submit 提交任务到工作池
-func (p *WorkerPool) Submit(job func()) {
-	p.jobQueue <- job
+// Size 返回运行中的工作协程数，缩减后尚未退出的工作协程也计算在内
+func (p *WorkerPool) Size() int {
+	return int(atomic.LoadInt32(&p.live))
 }
 
-// Close 关闭工作池
+// Submit 提交任务到工作池，任务队列已满时阻塞，工作池关闭后返回 ErrPoolClosed
+//
+// 阻塞等待时不持有锁，Close 不必等到队列腾出空间，阻塞中的提交随关闭返回 ErrPoolClosed。
+func (p *WorkerPool) Submit(job func()) error {
+	p.closeMutex.RLock()
+	if p.closed {
+		p.closeMutex.RUnlock()
+		return ErrPoolClosed
+	}
+	p.submitting.Add(1)
+	p.closeMutex.RUnlock()
+	defer p.submitting.Done()
+
+	atomic.AddInt64(&p.pending, 1)
+	select {
+	case p.jobQueue <- job:
+		return nil
+	case <-p.done:
+		atomic.AddInt64(&p.pending, -1)
+		return ErrPoolClosed
+	}
+}
+
+// Idle 判断所有已提交的任务是否都已执行完
+func (p *WorkerPool) Idle() bool {
+	return atomic.LoadInt64(&p.pending) == 0
+}
+
+// QueueDepth 返回等待执行的任务数
+func (p *WorkerPool) QueueDepth() int {
+	return len(p.jobQueue)
+}
+
+// Busy 返回正在执行任务的工作协程数
+func (p *WorkerPool) Busy() int {
+	return int(atomic.LoadInt32(&p.busy))
+}
+
+// Saturated 判断任务队列是否已满，已满时提交任务会阻塞
+func (p *WorkerPool) Saturated() bool {
+	return len(p.jobQueue) >= cap(p.jobQueue)
+}
+
+// Stalled 判断工作池是否卡死：有任务执行或等待，但超过timeout没有任务开始或结束
+func (p *WorkerPool) Stalled(timeout time.Duration) bool {
+	if p.Busy() == 0 && p.QueueDepth() == 0 {
+		return false
+	}
+	lastActive := time.Unix(0, atomic.LoadInt64(&p.lastActive))
+	return time.Since(lastActive) > timeout
+}
+
+// Close 关闭工作池，等待已提交的任务执行完
 func (p *WorkerPool) Close() {
+	p.closeMutex.Lock()
+	if p.closed {
+		p.closeMutex.Unlock()
+		return
+	}
+	p.closed = true
+	p.closeMutex.Unlock()
+
+	// 唤醒阻塞中的提交，全部返回后再关闭任务队列
+	close(p.done)
+	p.submitting.Wait()
 	close(p.jobQueue)
 	p.wg.Wait()
+
+	// 工作协程都已退出，缩减到0后仍留在队列中的任务在此执行
+	for job := range p.jobQueue {
+		job()
+		atomic.AddInt64(&p.pending, -1)
+	}
 	log.Println("工作池已关闭")
-}
\ No newline at end of file
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// eventually 在2秒内等待 cond 成立
+func eventually(t *testing.T, cond func() bool, format string, args ...any) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf(format, args...)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// occupy 提交 n 个阻塞任务，等待它们全部开始执行，关闭 release 后任务结束
+func occupy(t *testing.T, p *WorkerPool, n int, release <-chan struct{}) {
+	t.Helper()
+	busy := p.Busy()
+	for i := 0; i < n; i++ {
+		if err := p.Submit(func() { <-release }); err != nil {
+			t.Fatalf("Submit() = %v", err)
+		}
+	}
+	eventually(t, func() bool { return p.Busy() == busy+n }, "执行中的任务数未达到%d", busy+n)
+}
+
+func TestWorkerPoolResize(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		running int // 调整前正在执行的任务数
+		target  int
+	}{
+		{"执行中缩减", 4, 4, 1},
+		{"部分空闲时缩减", 4, 2, 1},
+		{"缩减到0", 2, 2, 0},
+		{"执行中扩容", 2, 2, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewWorkerPool(tt.workers)
+			defer p.Close()
+			release := make(chan struct{})
+			var once sync.Once
+			done := func() { once.Do(func() { close(release) }) }
+			defer done()
+			occupy(t, p, tt.running, release)
+
+			p.Resize(tt.target)
+			// 通知退出的工作协程中，空闲的立即退出，执行任务的完成当前任务后才退出；
+			// 哪些工作协程在执行任务不确定，运行中的最多为目标数加上执行任务的退出协程数
+			stopped := tt.workers - tt.target
+			if stopped < 0 {
+				stopped = 0
+			}
+			if stopped > tt.running {
+				stopped = tt.running
+			}
+			atMost := tt.target + stopped
+			eventually(t, func() bool { return p.Size() <= atMost }, "调整后 Size() 未降到%d", atMost)
+			if p.Size() < tt.running || p.Size() < tt.target {
+				t.Fatalf("调整后 Size() = %d, 期望不少于%d和%d", p.Size(), tt.running, tt.target)
+			}
+			if p.Busy() != tt.running {
+				t.Fatalf("调整后执行中的任务数为%d, 期望%d", p.Busy(), tt.running)
+			}
+
+			done()
+			eventually(t, func() bool { return p.Size() == tt.target }, "任务结束后 Size() 未达到%d", tt.target)
+			eventually(t, p.Idle, "任务结束后工作池不空闲")
+
+			// 调整后提交的任务仍能执行，缩减到0时由 Close 执行
+			var ran int32
+			if err := p.Submit(func() { atomic.AddInt32(&ran, 1) }); err != nil {
+				t.Fatalf("Submit() = %v", err)
+			}
+			if tt.target == 0 {
+				p.Close()
+			}
+			eventually(t, func() bool { return atomic.LoadInt32(&ran) == 1 }, "调整后提交的任务没有执行")
+		})
+	}
+}
+
+func TestWorkerPoolCloseWakesSubmit(t *testing.T) {
+	p := NewWorkerPool(1)
+	release := make(chan struct{})
+	occupy(t, p, 1, release)
+
+	// 填满任务队列，再提交的任务阻塞
+	var ran int32
+	for i := 0; i < 2; i++ {
+		if err := p.Submit(func() { atomic.AddInt32(&ran, 1) }); err != nil {
+			t.Fatalf("Submit() = %v", err)
+		}
+	}
+	if !p.Saturated() {
+		t.Fatal("任务队列未满")
+	}
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- p.Submit(func() { atomic.AddInt32(&ran, 1) })
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		p.Close()
+		close(closed)
+	}()
+
+	// 关闭唤醒阻塞中的提交，不必等到任务队列腾出空间
+	select {
+	case err := <-blocked:
+		if err != ErrPoolClosed {
+			t.Fatalf("阻塞中的 Submit() = %v, 期望 %v", err, ErrPoolClosed)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close() 没有唤醒阻塞中的 Submit()")
+	}
+	if err := p.Submit(func() {}); err != ErrPoolClosed {
+		t.Fatalf("关闭后 Submit() = %v, 期望 %v", err, ErrPoolClosed)
+	}
+
+	// 已进入队列的任务在关闭前执行完
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close() 没有返回")
+	}
+	if got := atomic.LoadInt32(&ran); got != 2 {
+		t.Fatalf("执行了%d个排队的任务, 期望2", got)
+	}
+	if !p.Idle() {
+		t.Fatal("关闭后工作池不空闲")
+	}
+}
@@ -0,0 +1,143 @@
+// Package signature 提供推送请求的HMAC-SHA256签名与校验
+//
+// 签名内容为 时间戳 + "\n" + 随机串 + "\n" + 请求体，结果以十六进制放在 X-Signature 请求头中。
+// 接收方可以直接使用 Verifier 校验签名并拒绝超出时间窗口或重复的请求。
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 签名相关的请求头
+const (
+	HeaderTimestamp = "X-Timestamp" // 秒级时间戳
+	HeaderNonce     = "X-Nonce"     // 随机串，同一时间窗口内不可重复
+	HeaderSignature = "X-Signature" // HMAC-SHA256签名（十六进制）
+)
+
+// 校验失败的原因
+var (
+	ErrMissingHeader    = errors.New("缺少签名请求头")
+	ErrInvalidTimestamp = errors.New("时间戳格式错误")
+	ErrExpired          = errors.New("时间戳超出允许的时间窗口")
+	ErrReplayed         = errors.New("随机串重复，疑似重放请求")
+	ErrInvalidSignature = errors.New("签名不正确")
+)
+
+// Sign 计算请求签名
+func Sign(secret, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewNonce 生成随机串
+func NewNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// SignRequest 为请求添加时间戳、随机串和签名请求头
+func SignRequest(req *http.Request, secret string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := NewNonce()
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, Sign(secret, timestamp, nonce, body))
+}
+
+// Verifier 签名校验器，记录时间窗口内出现过的随机串用于防重放
+type Verifier struct {
+	secret    string
+	window    time.Duration
+	nonces    map[string]time.Time
+	lastSweep time.Time
+	mutex     sync.Mutex
+}
+
+// NewVerifier 创建签名校验器，window 为允许的时间戳偏差
+func NewVerifier(secret string, window time.Duration) *Verifier {
+	return &Verifier{
+		secret: secret,
+		window: window,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Verify 校验请求头中的签名
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	timestamp := header.Get(HeaderTimestamp)
+	nonce := header.Get(HeaderNonce)
+	sign := header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || sign == "" {
+		return ErrMissingHeader
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	now := time.Now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.window)) || signedAt.After(now.Add(v.window)) {
+		return ErrExpired
+	}
+
+	expected := Sign(v.secret, timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(sign)) {
+		return ErrInvalidSignature
+	}
+
+	// 签名正确后再登记随机串，避免伪造请求占满缓存
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.expire(now)
+	if _, ok := v.nonces[nonce]; ok {
+		return ErrReplayed
+	}
+	v.nonces[nonce] = signedAt
+	return nil
+}
+
+// VerifyRequest 读取请求体并校验签名，校验后请求体可以被再次读取
+func (v *Verifier) VerifyRequest(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取请求体失败: %v", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, v.Verify(r.Header, body)
+}
+
+// expire 清理已超出时间窗口的随机串，每个时间窗口最多清理一次
+func (v *Verifier) expire(now time.Time) {
+	if now.Sub(v.lastSweep) < v.window {
+		return
+	}
+	v.lastSweep = now
+	for nonce, signedAt := range v.nonces {
+		if signedAt.Before(now.Add(-v.window)) {
+			delete(v.nonces, nonce)
+		}
+	}
+}
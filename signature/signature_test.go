@@ -0,0 +1,139 @@
+package signature
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "test-secret"
+
+// signedHeader 按 SignRequest 的规则生成请求头，签名时间为 signedAt
+func signedHeader(secret, nonce string, signedAt time.Time, body []byte) http.Header {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	header := make(http.Header)
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderNonce, nonce)
+	header.Set(HeaderSignature, Sign(secret, timestamp, nonce, body))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"callId":"NM0001","eventType":1}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		replay  bool // 先用同样的请求头校验一次
+		wantErr error
+	}{
+		{
+			name:   "签名正确",
+			header: signedHeader(testSecret, "n-valid", now, body),
+			body:   body,
+		},
+		{
+			name:   "时间窗口边缘内",
+			header: signedHeader(testSecret, "n-edge", now.Add(-4*time.Minute), body),
+			body:   body,
+		},
+		{
+			name:    "请求体被篡改",
+			header:  signedHeader(testSecret, "n-tampered", now, body),
+			body:    []byte(`{"callId":"NM0001","eventType":4}`),
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "密钥不一致",
+			header:  signedHeader("other-secret", "n-secret", now, body),
+			body:    body,
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "时间戳已过期",
+			header:  signedHeader(testSecret, "n-expired", now.Add(-10*time.Minute), body),
+			body:    body,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "时间戳超前",
+			header:  signedHeader(testSecret, "n-future", now.Add(10*time.Minute), body),
+			body:    body,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "随机串重放",
+			header:  signedHeader(testSecret, "n-replayed", now, body),
+			body:    body,
+			replay:  true,
+			wantErr: ErrReplayed,
+		},
+		{
+			name:    "缺少签名",
+			header:  http.Header{HeaderTimestamp: {strconv.FormatInt(now.Unix(), 10)}, HeaderNonce: {"n-missing"}},
+			body:    body,
+			wantErr: ErrMissingHeader,
+		},
+		{
+			name:    "时间戳格式错误",
+			header:  http.Header{HeaderTimestamp: {"yesterday"}, HeaderNonce: {"n-format"}, HeaderSignature: {"00"}},
+			body:    body,
+			wantErr: ErrInvalidTimestamp,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(testSecret, 5*time.Minute)
+			if tt.replay {
+				if err := v.Verify(tt.header, tt.body); err != nil {
+					t.Fatalf("第一次校验失败: %v", err)
+				}
+			}
+			err := v.Verify(tt.header, tt.body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() = %v, 期望 %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectedNonceNotRecorded(t *testing.T) {
+	// 签名错误的请求不登记随机串，之后使用同一随机串的正确请求仍然通过
+	body := []byte(`{"callId":"NM0002"}`)
+	now := time.Now()
+	v := NewVerifier(testSecret, 5*time.Minute)
+
+	if err := v.Verify(signedHeader("forged", "n-shared", now, body), body); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("伪造请求 Verify() = %v, 期望 %v", err, ErrInvalidSignature)
+	}
+	if err := v.Verify(signedHeader(testSecret, "n-shared", now, body), body); err != nil {
+		t.Fatalf("正确请求 Verify() = %v", err)
+	}
+}
+
+func TestSignRequestRoundTrip(t *testing.T) {
+	body := `{"callId":"NM0003"}`
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/callback/v1/status", strings.NewReader(body))
+	SignRequest(req, testSecret, []byte(body))
+
+	v := NewVerifier(testSecret, time.Minute)
+	got, err := v.VerifyRequest(req)
+	if err != nil {
+		t.Fatalf("VerifyRequest() = %v", err)
+	}
+	if string(got) != body {
+		t.Fatalf("VerifyRequest() 返回的请求体为 %q, 期望 %q", got, body)
+	}
+
+	// 同一请求再次校验视为重放
+	if _, err := v.VerifyRequest(req); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("再次校验 VerifyRequest() = %v, 期望 %v", err, ErrReplayed)
+	}
+}